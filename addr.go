@@ -0,0 +1,28 @@
+package sers
+
+// SerialAddr is the address of a serial port. It implements net.Addr so that
+// serial ports can be used where a net.Conn is expected.
+type SerialAddr struct {
+	// Path is the file name the serial port was opened with.
+	Path string
+	// Mode is the mode the port was in when the address was retrieved. It
+	// is the zero Mode if the mode could not be determined.
+	Mode Mode
+}
+
+// Network returns the address' network name, "serial".
+func (sa *SerialAddr) Network() string {
+	return "serial"
+}
+
+// String returns the path of the serial port, followed by its mode if the
+// mode is known, as in "/dev/ttyUSB0@115200,8n1,none".
+func (sa *SerialAddr) String() string {
+	if sa == nil {
+		return "<nil>"
+	}
+	if sa.Mode == (Mode{}) {
+		return sa.Path
+	}
+	return sa.Path + "@" + sa.Mode.String()
+}
@@ -0,0 +1,359 @@
+// Package bridge exposes a serial port on a TCP listener, in the manner of
+// ser2net's raw mode. Data received on the port is sent to the connected
+// clients, data received from the controlling client is written to the port.
+//
+// The Policy of a Server decides what happens when a client connects while
+// another one is already connected.
+package bridge
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/distributed/sers"
+)
+
+// Policy decides how a Server handles more than one client.
+type Policy int
+
+const (
+	// Exclusive allows only one client at a time. Further clients are
+	// disconnected right away.
+	Exclusive Policy = iota
+
+	// Shared lets further clients observe the data received on the port.
+	// Only the first client controls the port, what the others send is
+	// discarded. When the controlling client disconnects, the observer
+	// that has been connected longest takes control.
+	Shared
+
+	// KickPrevious disconnects the current client when a new one connects.
+	KickPrevious
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Exclusive:
+		return "exclusive"
+	case Shared:
+		return "shared"
+	case KickPrevious:
+		return "kick"
+	}
+	return "invalid_policy"
+}
+
+// ParsePolicy parses the names returned by Policy.String: "exclusive",
+// "shared" and "kick".
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range []Policy{Exclusive, Shared, KickPrevious} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, &sers.ParameterError{Parameter: "policy", Reason: "unknown policy " + s}
+}
+
+// ErrServerClosed is returned by Serve after Close has been called.
+var ErrServerClosed = errors.New("bridge: server closed")
+
+// clientQueue is the number of chunks of data that are queued for a client.
+// Clients that fall further behind are disconnected.
+const clientQueue = 64
+
+// Server bridges a serial port and TCP clients.
+//
+// The Server owns the port: the port is read as soon as Serve is called and
+// closed by Close. Serve sets the port's read parameters with
+// SetReadParams(1, 0), so that reads block until data arrives.
+type Server struct {
+	Port   sers.SerialPort
+	Policy Policy
+
+	// Log receives messages about clients connecting and disconnecting.
+	// If nil, nothing is logged.
+	Log *log.Logger
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	clients    map[*client]struct{}
+	controller *client
+	observers  []*client // in the order they connected
+	reading    bool
+	closed     bool
+	portErr    error
+}
+
+type client struct {
+	conn net.Conn
+	out  chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on l until Close is called, reading the port fails
+// or accepting fails. It returns ErrServerClosed, the error from the port
+// or the error from Accept, respectively. l is closed on return. Serve may
+// be called for several listeners at once.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if err := s.stopErr(); err != nil {
+		s.mu.Unlock()
+		l.Close()
+		return err
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.clients = make(map[*client]struct{})
+	}
+	if !s.reading {
+		// reads that time out would make readPort spin.
+		if err := s.Port.SetReadParams(1, 0); err != nil {
+			s.mu.Unlock()
+			l.Close()
+			return err
+		}
+		s.reading = true
+		go s.readPort()
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			if serr := s.stopErr(); serr != nil {
+				err = serr
+			}
+			s.mu.Unlock()
+			return err
+		}
+		s.add(conn)
+	}
+}
+
+// stopErr returns why the server stopped, or nil if it is running. It has to
+// be called with s.mu held.
+func (s *Server) stopErr() error {
+	if s.closed {
+		return ErrServerClosed
+	}
+	return s.portErr
+}
+
+// Close stops all calls to Serve, disconnects all clients and closes the
+// port.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.portErr == nil {
+		s.shutdown()
+	}
+	s.mu.Unlock()
+
+	return s.Port.Close()
+}
+
+// shutdown closes listeners and clients. It has to be called with s.mu
+// held.
+func (s *Server) shutdown() {
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.clients {
+		c.close()
+	}
+}
+
+func (s *Server) add(conn net.Conn) {
+	c := &client{
+		conn: conn,
+		out:  make(chan []byte, clientQueue),
+		done: make(chan struct{}),
+	}
+	addr := conn.RemoteAddr()
+
+	s.mu.Lock()
+	if s.stopErr() != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if s.controller != nil {
+		switch s.Policy {
+		case Shared:
+			s.clients[c] = struct{}{}
+			s.observers = append(s.observers, c)
+			s.mu.Unlock()
+			s.logf("%v connected as observer", addr)
+			go s.serveClient(c)
+			return
+		case KickPrevious:
+			prev := s.controller
+			s.removeLocked(prev)
+			s.logf("%v disconnected in favour of %v", prev.conn.RemoteAddr(), addr)
+		default:
+			s.mu.Unlock()
+			conn.Close()
+			s.logf("%v refused, port in use", addr)
+			return
+		}
+	}
+	s.clients[c] = struct{}{}
+	s.controller = c
+	s.mu.Unlock()
+
+	s.logf("%v connected", addr)
+	go s.serveClient(c)
+}
+
+func (s *Server) remove(c *client) {
+	s.mu.Lock()
+	s.removeLocked(c)
+	s.mu.Unlock()
+}
+
+func (s *Server) removeLocked(c *client) {
+	for i, o := range s.observers {
+		if o == c {
+			s.observers = append(s.observers[:i], s.observers[i+1:]...)
+			break
+		}
+	}
+	if s.controller == c {
+		s.controller = nil
+		if len(s.observers) > 0 {
+			s.controller = s.observers[0]
+			s.observers = s.observers[1:]
+			s.logf("%v took control", s.controller.conn.RemoteAddr())
+		}
+	}
+	delete(s.clients, c)
+	c.close()
+}
+
+func (s *Server) isController(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.controller == c
+}
+
+// serveClient forwards data from the port to c in the background and data
+// from c to the port, as long as c is in control.
+func (s *Server) serveClient(c *client) {
+	go func() {
+		for {
+			select {
+			case data := <-c.out:
+				if _, err := c.conn.Write(data); err != nil {
+					s.remove(c)
+					return
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 1024)
+	for {
+		n, err := c.conn.Read(buf)
+		if n > 0 && s.isController(c) {
+			if _, werr := s.Port.Write(buf[:n]); werr != nil {
+				s.logf("writing to port: %v", werr)
+				s.remove(c)
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				select {
+				case <-c.done:
+				default:
+					s.logf("%v: %v", c.conn.RemoteAddr(), err)
+				}
+			}
+			s.remove(c)
+			s.logf("%v disconnected", c.conn.RemoteAddr())
+			return
+		}
+	}
+}
+
+type timeout interface {
+	Timeout() bool
+}
+
+// readPort sends the data read from the port to all clients.
+func (s *Server) readPort() {
+	buf := make([]byte, 1024)
+	for {
+		n, err := s.Port.Read(buf)
+		if n > 0 {
+			s.broadcast(append([]byte(nil), buf[:n]...))
+		}
+		if err != nil {
+			if t, ok := err.(timeout); ok && t.Timeout() {
+				continue
+			}
+
+			s.mu.Lock()
+			if !s.closed {
+				s.portErr = err
+				s.shutdown()
+			}
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (s *Server) broadcast(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c.out <- data:
+		default:
+			s.logf("%v not keeping up, disconnecting", c.conn.RemoteAddr())
+			s.removeLocked(c)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package bridge
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+// logBuffer collects log messages for the test to wait on.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (lb *logBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.Write(p)
+}
+
+func (lb *logBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.String()
+}
+
+type testBridge struct {
+	t      *testing.T
+	srv    *Server
+	device sers.SerialPort
+	addr   string
+	log    *logBuffer
+	served chan error
+}
+
+// newTestBridge serves the master of a pty pair, the slave plays the
+// device.
+func newTestBridge(t *testing.T, policy Policy) *testBridge {
+	pp, err := sers.OpenPTYPair()
+	if err != nil {
+		t.Skipf("no pseudo terminals available: %v", err)
+	}
+	if err := pp.Slave.SetReadParams(0, 2.0); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		pp.Close()
+		t.Fatal(err)
+	}
+
+	tb := &testBridge{
+		t:      t,
+		device: pp.Slave,
+		addr:   l.Addr().String(),
+		log:    &logBuffer{},
+		served: make(chan error, 1),
+	}
+	tb.srv = &Server{
+		Port:   pp.Master,
+		Policy: policy,
+		Log:    log.New(tb.log, "", 0),
+	}
+	go func() { tb.served <- tb.srv.Serve(l) }()
+	return tb
+}
+
+func (tb *testBridge) close() {
+	tb.srv.Close()
+	tb.device.Close()
+}
+
+func (tb *testBridge) dial() net.Conn {
+	tb.t.Helper()
+	conn, err := net.Dial("tcp", tb.addr)
+	if err != nil {
+		tb.t.Fatal(err)
+	}
+	return conn
+}
+
+func (tb *testBridge) waitLog(msg string) {
+	tb.t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if strings.Contains(tb.log.String(), msg) {
+			return
+		}
+	}
+	tb.t.Fatalf("%q not logged, log:\n%s", msg, tb.log)
+}
+
+func (tb *testBridge) toDevice(conn net.Conn, msg string) {
+	tb.t.Helper()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		tb.t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(tb.device, buf); err != nil {
+		tb.t.Fatalf("device reading %q: %v", msg, err)
+	}
+	if string(buf) != msg {
+		tb.t.Errorf("device read %q, want %q", buf, msg)
+	}
+}
+
+func (tb *testBridge) fromDevice(msg string, conns ...net.Conn) {
+	tb.t.Helper()
+	if _, err := tb.device.Write([]byte(msg)); err != nil {
+		tb.t.Fatal(err)
+	}
+	for _, conn := range conns {
+		expectRead(tb.t, conn, msg)
+	}
+}
+
+func expectRead(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("client reading %q: %v", msg, err)
+	}
+	if string(buf) != msg {
+		t.Errorf("client read %q, want %q", buf, msg)
+	}
+}
+
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != io.EOF {
+		t.Errorf("client read %q, %v, want EOF", buf[:n], err)
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	tb := newTestBridge(t, Exclusive)
+	defer tb.close()
+
+	c1 := tb.dial()
+	defer c1.Close()
+	tb.toDevice(c1, "hello")
+	tb.fromDevice("world", c1)
+
+	c2 := tb.dial()
+	defer c2.Close()
+	expectClosed(t, c2)
+	tb.waitLog("refused")
+
+	// the first client is not affected
+	tb.toDevice(c1, "again")
+
+	// and once it is gone, the port is free
+	c1.Close()
+	tb.waitLog("disconnected")
+	c3 := tb.dial()
+	defer c3.Close()
+	tb.toDevice(c3, "next")
+	tb.fromDevice("ok", c3)
+}
+
+func TestShared(t *testing.T) {
+	tb := newTestBridge(t, Shared)
+	defer tb.close()
+
+	c1 := tb.dial()
+	defer c1.Close()
+	tb.toDevice(c1, "hello")
+
+	c2 := tb.dial()
+	defer c2.Close()
+	tb.waitLog("observer")
+
+	tb.fromDevice("to everyone", c1, c2)
+
+	// the observer's data is dropped
+	if _, err := c2.Write([]byte("ignored")); err != nil {
+		t.Fatal(err)
+	}
+	tb.toDevice(c1, "controller")
+
+	// the observer takes over once the controller has gone, clients that
+	// connect later observe
+	c1.Close()
+	tb.waitLog(c2.LocalAddr().String() + " took control")
+	c3 := tb.dial()
+	defer c3.Close()
+	tb.waitLog(c3.LocalAddr().String() + " connected as observer")
+	if _, err := c3.Write([]byte("ignored")); err != nil {
+		t.Fatal(err)
+	}
+	tb.toDevice(c2, "new controller")
+	tb.fromDevice("still there", c2, c3)
+}
+
+func TestKickPrevious(t *testing.T) {
+	tb := newTestBridge(t, KickPrevious)
+	defer tb.close()
+
+	c1 := tb.dial()
+	defer c1.Close()
+	tb.toDevice(c1, "hello")
+
+	c2 := tb.dial()
+	defer c2.Close()
+	expectClosed(t, c1)
+	tb.toDevice(c2, "took over")
+	tb.fromDevice("reply", c2)
+}
+
+func TestServerClose(t *testing.T) {
+	tb := newTestBridge(t, Exclusive)
+	defer tb.device.Close()
+
+	c1 := tb.dial()
+	defer c1.Close()
+	tb.toDevice(c1, "hello")
+
+	if err := tb.srv.Close(); err != nil {
+		t.Error(err)
+	}
+	expectClosed(t, c1)
+	select {
+	case err := <-tb.served:
+		if err != ErrServerClosed {
+			t.Errorf("Serve returned %v, want %v", err, ErrServerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []Policy{Exclusive, Shared, KickPrevious} {
+		got, err := ParsePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParsePolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParsePolicy("everyone"); err == nil {
+		t.Error("ParsePolicy accepted an unknown policy")
+	}
+}
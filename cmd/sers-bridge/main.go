@@ -0,0 +1,167 @@
+// Command sers-bridge exposes serial ports on TCP listeners, like ser2net
+// in raw mode.
+//
+// A single port is given on the command line:
+//
+//	sers-bridge [-policy exclusive|shared|kick] <address> <device> [<modestring>]
+//
+// for example
+//
+//	sers-bridge -policy shared :2001 /dev/ttyUSB0 115200,8n1
+//
+// Several ports are described in a file passed with -config, one port per
+// line in the same order, with an optional policy at the end:
+//
+//	# address  device        mode        policy
+//	:2001      /dev/ttyUSB0  115200,8n1  shared
+//	:2002      /dev/ttyUSB1  9600,7e1
+//
+// Empty lines and lines starting with '#' are ignored. Without a policy,
+// the one given by -policy applies.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/distributed/sers"
+	"github.com/distributed/sers/bridge"
+)
+
+type portConfig struct {
+	addr   string
+	device string
+	mode   string
+	policy bridge.Policy
+}
+
+func main() {
+	err := Main()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func Main() error {
+	config := flag.String("config", "", "read the ports to bridge from `file`")
+	policyName := flag.String("policy", "exclusive", "client policy: exclusive, shared or kick")
+	flag.Parse()
+
+	policy, err := bridge.ParsePolicy(*policyName)
+	if err != nil {
+		return err
+	}
+
+	var ports []portConfig
+	if *config != "" {
+		if flag.NArg() > 0 {
+			return fmt.Errorf("extraneous arguments: %q", flag.Args())
+		}
+		ports, err = readConfig(*config, policy)
+		if err != nil {
+			return err
+		}
+	} else {
+		pc, err := parsePortConfig(flag.Args(), policy)
+		if err != nil {
+			return err
+		}
+		ports = append(ports, pc)
+	}
+
+	errc := make(chan error, len(ports))
+	for _, pc := range ports {
+		srv, err := open(pc)
+		if err != nil {
+			return err
+		}
+		go func(pc portConfig) {
+			errc <- fmt.Errorf("%s: %v", pc.device, srv.ListenAndServe(pc.addr))
+		}(pc)
+	}
+
+	// one failing port takes down the others, so that a supervisor notices
+	return <-errc
+}
+
+func parsePortConfig(fields []string, policy bridge.Policy) (portConfig, error) {
+	if len(fields) < 2 {
+		return portConfig{}, fmt.Errorf("please provide an address and a device")
+	} else if len(fields) > 4 {
+		return portConfig{}, fmt.Errorf("extraneous arguments: %q", fields[4:])
+	}
+
+	pc := portConfig{addr: fields[0], device: fields[1], policy: policy}
+	if len(fields) >= 3 {
+		pc.mode = fields[2]
+		if _, err := sers.ParseModestring(pc.mode); err != nil {
+			return portConfig{}, err
+		}
+	}
+	if len(fields) == 4 {
+		var err error
+		pc.policy, err = bridge.ParsePolicy(fields[3])
+		if err != nil {
+			return portConfig{}, err
+		}
+	}
+	return pc, nil
+}
+
+func readConfig(fn string, policy bridge.Policy) ([]portConfig, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ports []portConfig
+	s := bufio.NewScanner(f)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pc, err := parsePortConfig(strings.Fields(line), policy)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fn, lineno, err)
+		}
+		ports = append(ports, pc)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("%s: no ports configured", fn)
+	}
+	return ports, nil
+}
+
+func open(pc portConfig) (*bridge.Server, error) {
+	sp, err := sers.Open(pc.device)
+	if err != nil {
+		return nil, err
+	}
+
+	if pc.mode != "" {
+		mode, err := sers.ParseModestring(pc.mode)
+		if err != nil {
+			sp.Close()
+			return nil, err
+		}
+		if err := sers.SetModeStruct(sp, mode); err != nil {
+			sp.Close()
+			return nil, fmt.Errorf("%s: %v", pc.device, err)
+		}
+	}
+	prefix := fmt.Sprintf("%s %s: ", pc.addr, pc.device)
+	return &bridge.Server{
+		Port:   sp,
+		Policy: pc.policy,
+		Log:    log.New(os.Stderr, prefix, log.LstdFlags),
+	}, nil
+}
@@ -0,0 +1,86 @@
+package sers
+
+import (
+	"context"
+	"time"
+)
+
+// ContextReadWriter is implemented by serial ports whose reads and writes can
+// be cancelled through a context. The serial ports returned by Open on
+// termios platforms implement it.
+type ContextReadWriter interface {
+	// ReadContext reads like Read, but returns early with ctx.Err() once
+	// ctx is done. Data read up to that point is reflected in the
+	// returned count.
+	ReadContext(ctx context.Context, p []byte) (int, error)
+
+	// WriteContext writes like Write, but returns early with ctx.Err()
+	// once ctx is done. Some bytes may have been written by then, which
+	// is reflected in the returned count.
+	WriteContext(ctx context.Context, p []byte) (int, error)
+}
+
+var errNoContext error = StringError("port does not support cancellation through a context")
+
+// ReadContext reads from sp, honouring cancellation of ctx if sp implements
+// ContextReadWriter. Otherwise, it only works with contexts that are never
+// done, such as context.Background().
+func ReadContext(ctx context.Context, sp SerialPort, p []byte) (int, error) {
+	if crw, ok := sp.(ContextReadWriter); ok {
+		return crw.ReadContext(ctx, p)
+	}
+	if ctx.Done() != nil {
+		return 0, &Error{"reading", errNoContext}
+	}
+	return sp.Read(p)
+}
+
+// WriteContext writes to sp, honouring cancellation of ctx if sp implements
+// ContextReadWriter. Otherwise, it only works with contexts that are never
+// done, such as context.Background().
+func WriteContext(ctx context.Context, sp SerialPort, p []byte) (int, error) {
+	if crw, ok := sp.(ContextReadWriter); ok {
+		return crw.WriteContext(ctx, p)
+	}
+	if ctx.Done() != nil {
+		return 0, &Error{"writing", errNoContext}
+	}
+	return sp.Write(p)
+}
+
+// aLongTimeAgo is a deadline that has passed for sure, for unblocking I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// ioContext runs op, which is blocked in I/O governed by the deadline set
+// through setDeadline, until ctx is done. The deadline is only touched if
+// ctx is done before op returns, it is cleared again afterwards. The helper
+// goroutine has terminated when ioContext returns.
+func ioContext(ctx context.Context, setDeadline func(time.Time) error, op func() (int, error)) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if ctx.Done() == nil {
+		return op()
+	}
+
+	stop := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			setDeadline(aLongTimeAgo)
+			cancelled <- true
+		case <-stop:
+			cancelled <- false
+		}
+	}()
+
+	n, err := op()
+	close(stop)
+	if <-cancelled {
+		setDeadline(time.Time{})
+		return n, ctx.Err()
+	}
+
+	return n, err
+}
@@ -0,0 +1,27 @@
+// +build darwin linux
+
+package sers
+
+import "context"
+
+var _ ContextReadWriter = (*baseport)(nil)
+
+// ReadContext reads like Read, but returns ctx.Err() once ctx is done. It
+// interrupts the read by setting a read deadline in the past, so if ctx is
+// done, a read deadline set through SetReadDeadline is cleared. Ports
+// obtained through TakeOver do not support it, as they do not support
+// deadlines.
+func (bp *baseport) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return ioContext(ctx, bp.SetReadDeadline, func() (int, error) {
+		return bp.Read(p)
+	})
+}
+
+// WriteContext writes like Write, but returns ctx.Err() once ctx is done. As
+// with ReadContext, a write deadline set through SetWriteDeadline is cleared
+// if ctx is done.
+func (bp *baseport) WriteContext(ctx context.Context, p []byte) (int, error) {
+	return ioContext(ctx, bp.f.SetWriteDeadline, func() (int, error) {
+		return bp.Write(p)
+	})
+}
@@ -0,0 +1,74 @@
+// +build darwin linux
+
+package sers
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestIOContext(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	goroutines := runtime.NumGoroutine()
+
+	read := func(ctx context.Context, p []byte) (int, error) {
+		return ioContext(ctx, r.SetReadDeadline, func() (int, error) {
+			return r.Read(p)
+		})
+	}
+	buf := make([]byte, 16)
+
+	// cancelled while blocked
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := read(ctx, buf); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("cancelled read took %v", d)
+	}
+
+	// cancelled before
+	if _, err := read(ctx, buf); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// deadline
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if _, err := read(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	cancel()
+
+	// the deadline used for interrupting does not stick
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := read(ctx, buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("got %q, %v, want %q, nil", buf[:n], err, "hello")
+	}
+	if _, err := w.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	n, err = read(context.Background(), buf)
+	if err != nil || string(buf[:n]) != "world" {
+		t.Errorf("got %q, %v, want %q, nil", buf[:n], err, "world")
+	}
+
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines left behind", n-goroutines)
+	}
+}
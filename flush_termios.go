@@ -0,0 +1,47 @@
+// +build darwin linux
+
+package sers
+
+import "context"
+
+var _ Flusher = (*baseport)(nil)
+
+func (bp *baseport) FlushInput() error {
+	if err := bp.flush(true, false); err != nil {
+		return &Error{"flushing input", err}
+	}
+	return nil
+}
+
+func (bp *baseport) FlushOutput() error {
+	if err := bp.flush(false, true); err != nil {
+		return &Error{"flushing output", err}
+	}
+	return nil
+}
+
+func (bp *baseport) Drain(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		bp.flush(false, true)
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bp.drain()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return &Error{"draining output", err}
+		}
+		return nil
+	case <-ctx.Done():
+		// waiting for the output to drain can not be interrupted, but
+		// it ends once there is no more output.
+		bp.flush(false, true)
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,302 @@
+// Package telnet implements the parts of the Telnet protocol, RFC 854,
+// needed for the Com Port Control Option of RFC 2217: escaping of data,
+// decoding of commands and negotiation of options.
+package telnet
+
+// Commands
+const (
+	SE   = 240 // end of subnegotiation
+	NOP  = 241
+	DM   = 242 // data mark
+	BRK  = 243 // break
+	IP   = 244 // interrupt process
+	AO   = 245 // abort output
+	AYT  = 246 // are you there
+	EC   = 247 // erase character
+	EL   = 248 // erase line
+	GA   = 249 // go ahead
+	SB   = 250 // start of subnegotiation
+	WILL = 251
+	WONT = 252
+	DO   = 253
+	DONT = 254
+	IAC  = 255 // interpret as command
+)
+
+// Options
+const (
+	Binary        = 0  // RFC 856
+	Echo          = 1  // RFC 857
+	SuppressGA    = 3  // RFC 858
+	ComPortOption = 44 // RFC 2217
+)
+
+// Subcommands of ComPortOption, as sent by the client. The server's
+// responses are offset by ServerOffset.
+const (
+	Signature          = 0
+	SetBaudrate        = 1
+	SetDatasize        = 2
+	SetParity          = 3
+	SetStopsize        = 4
+	SetControl         = 5
+	NotifyLinestate    = 6
+	NotifyModemstate   = 7
+	FlowcontrolSuspend = 8
+	FlowcontrolResume  = 9
+	SetLinestateMask   = 10
+	SetModemstateMask  = 11
+	PurgeData          = 12
+
+	ServerOffset = 100
+)
+
+// Values of SetParity. 0 requests the current setting, as it does for
+// SetBaudrate, SetDatasize and SetStopsize.
+const (
+	ParityNone  = 1
+	ParityOdd   = 2
+	ParityEven  = 3
+	ParityMark  = 4
+	ParitySpace = 5
+)
+
+// Values of SetStopsize
+const (
+	Stopsize1   = 1
+	Stopsize2   = 2
+	Stopsize1_5 = 3
+)
+
+// Values of SetControl
+const (
+	ControlFlowRequest    = 0
+	ControlFlowNone       = 1
+	ControlFlowXonXoff    = 2
+	ControlFlowHardware   = 3
+	ControlBreakRequest   = 4
+	ControlBreakOn        = 5
+	ControlBreakOff       = 6
+	ControlDTRRequest     = 7
+	ControlDTROn          = 8
+	ControlDTROff         = 9
+	ControlRTSRequest     = 10
+	ControlRTSOn          = 11
+	ControlRTSOff         = 12
+	ControlInFlowRequest  = 13
+	ControlInFlowNone     = 14
+	ControlInFlowXonXoff  = 15
+	ControlInFlowHardware = 16
+	ControlFlowDCD        = 17
+	ControlInFlowDTR      = 18
+	ControlFlowDSR        = 19
+)
+
+// Bits of NotifyModemstate
+const (
+	ModemDeltaCTS   = 0x01
+	ModemDeltaDSR   = 0x02
+	ModemTrailingRI = 0x04
+	ModemDeltaDCD   = 0x08
+	ModemCTS        = 0x10
+	ModemDSR        = 0x20
+	ModemRI         = 0x40
+	ModemDCD        = 0x80
+)
+
+// Values of PurgeData
+const (
+	PurgeReceive  = 1 // data received from the serial port
+	PurgeTransmit = 2 // data to be transmitted on the serial port
+	PurgeBoth     = 3
+)
+
+// Escape appends p to dst, doubling IAC bytes.
+func Escape(dst, p []byte) []byte {
+	for _, b := range p {
+		if b == IAC {
+			dst = append(dst, IAC)
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// Subnegotiation returns the subnegotiation of option with the given
+// parameters.
+func Subnegotiation(option byte, params ...byte) []byte {
+	msg := []byte{IAC, SB, option}
+	msg = Escape(msg, params)
+	return append(msg, IAC, SE)
+}
+
+// Command is a command received from the peer.
+type Command struct {
+	// Verb is the command, e.g. WILL or BRK. Subnegotiations have verb SB.
+	Verb byte
+	// Option is the option of WILL, WONT, DO, DONT and SB.
+	Option byte
+	// Params are the parameters of a subnegotiation, with IAC unescaped.
+	Params []byte
+}
+
+// decoder states
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSBOption
+	stateSB
+	stateSBIAC
+)
+
+// Decoder separates the data received from the peer from the commands
+// embedded in it. Its zero value is ready for use.
+type Decoder struct {
+	state int
+	cmd   Command
+}
+
+// Decode decodes p in place. It calls handle for every complete command,
+// together with the data that preceded the command in p and has not been
+// passed to handle yet, so that the order of data and commands can be kept.
+// It returns the number of data bytes following the last command, which are
+// left at the start of p. Commands may span calls.
+func (d *Decoder) Decode(p []byte, handle func(data []byte, cmd Command)) int {
+	n := 0
+	emit := func(cmd Command) {
+		handle(p[:n], cmd)
+		n = 0
+	}
+	for _, b := range p {
+		switch d.state {
+		case stateData:
+			if b == IAC {
+				d.state = stateIAC
+				continue
+			}
+			p[n] = b
+			n++
+		case stateIAC:
+			switch b {
+			case IAC:
+				p[n] = b
+				n++
+				d.state = stateData
+			case WILL, WONT, DO, DONT:
+				d.cmd = Command{Verb: b}
+				d.state = stateOption
+			case SB:
+				d.cmd = Command{Verb: b}
+				d.state = stateSBOption
+			default:
+				d.state = stateData
+				emit(Command{Verb: b})
+			}
+		case stateOption:
+			d.cmd.Option = b
+			d.state = stateData
+			emit(d.cmd)
+		case stateSBOption:
+			d.cmd.Option = b
+			d.state = stateSB
+		case stateSB:
+			if b == IAC {
+				d.state = stateSBIAC
+				continue
+			}
+			d.cmd.Params = append(d.cmd.Params, b)
+		case stateSBIAC:
+			switch b {
+			case IAC:
+				d.cmd.Params = append(d.cmd.Params, b)
+				d.state = stateSB
+			case SE:
+				d.state = stateData
+				emit(d.cmd)
+			default:
+				// protocol violation, drop the subnegotiation
+				d.state = stateData
+			}
+		}
+	}
+	return n
+}
+
+// Options negotiates options with the peer, avoiding negotiation loops as
+// described in RFC 854.
+type Options struct {
+	// Local and Remote are the options that may be enabled on this side and
+	// on the peer's side, respectively.
+	Local, Remote []byte
+
+	us, them         [256]bool
+	usWant, themWant [256]bool
+}
+
+func contains(opts []byte, opt byte) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// Request appends requests to enable all of Local and Remote to dst.
+func (o *Options) Request(dst []byte) []byte {
+	for _, opt := range o.Local {
+		if !o.us[opt] && !o.usWant[opt] {
+			o.usWant[opt] = true
+			dst = append(dst, IAC, WILL, opt)
+		}
+	}
+	for _, opt := range o.Remote {
+		if !o.them[opt] && !o.themWant[opt] {
+			o.themWant[opt] = true
+			dst = append(dst, IAC, DO, opt)
+		}
+	}
+	return dst
+}
+
+// Handle processes a WILL, WONT, DO or DONT command received from the peer
+// and appends the reply, if any, to dst.
+func (o *Options) Handle(dst []byte, verb, opt byte) []byte {
+	switch verb {
+	case WILL, WONT:
+		return negotiate(dst, verb == WILL, contains(o.Remote, opt), &o.them[opt], &o.themWant[opt], DO, DONT, opt)
+	case DO, DONT:
+		return negotiate(dst, verb == DO, contains(o.Local, opt), &o.us[opt], &o.usWant[opt], WILL, WONT, opt)
+	}
+	return dst
+}
+
+func negotiate(dst []byte, enable, supported bool, enabled, want *bool, yes, no, opt byte) []byte {
+	requested := *want
+	*want = false
+	switch {
+	case enable && *enabled:
+	case enable && supported:
+		*enabled = true
+		if !requested {
+			dst = append(dst, IAC, yes, opt)
+		}
+	case enable:
+		dst = append(dst, IAC, no, opt)
+	case *enabled:
+		*enabled = false
+		dst = append(dst, IAC, no, opt)
+	}
+	return dst
+}
+
+// LocalEnabled reports whether opt is enabled on this side.
+func (o *Options) LocalEnabled(opt byte) bool {
+	return o.us[opt]
+}
+
+// RemoteEnabled reports whether opt is enabled on the peer's side.
+func (o *Options) RemoteEnabled(opt byte) bool {
+	return o.them[opt]
+}
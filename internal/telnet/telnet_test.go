@@ -0,0 +1,92 @@
+package telnet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	stream := []byte{'a', IAC, IAC, 'b', IAC, WILL, ComPortOption, 'c', IAC, NOP,
+		IAC, SB, ComPortOption, SetBaudrate + ServerOffset, 0, 0, IAC, IAC, 0, IAC, SE, 'd'}
+	expData := []byte{'a', IAC, 'b', 'c', 'd'}
+	expCmds := []Command{
+		{Verb: WILL, Option: ComPortOption},
+		{Verb: NOP},
+		{Verb: SB, Option: ComPortOption, Params: []byte{SetBaudrate + ServerOffset, 0, 0, IAC, 0}},
+	}
+	// the amount of data that precedes each command
+	expAt := []int{3, 4, 4}
+
+	// all at once, and byte by byte
+	for _, chunk := range []int{len(stream), 1} {
+		var d Decoder
+		var data []byte
+		var cmds []Command
+		var at []int
+		for i := 0; i < len(stream); i += chunk {
+			p := append([]byte(nil), stream[i:i+chunk]...)
+			n := d.Decode(p, func(pre []byte, cmd Command) {
+				data = append(data, pre...)
+				cmds = append(cmds, cmd)
+				at = append(at, len(data))
+			})
+			data = append(data, p[:n]...)
+		}
+		if !bytes.Equal(data, expData) {
+			t.Errorf("chunks of %d: got data %v, want %v", chunk, data, expData)
+		}
+		if !reflect.DeepEqual(cmds, expCmds) {
+			t.Errorf("chunks of %d: got commands %v, want %v", chunk, cmds, expCmds)
+		}
+		if !reflect.DeepEqual(at, expAt) {
+			t.Errorf("chunks of %d: commands after %v data bytes, want %v", chunk, at, expAt)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	got := Escape([]byte{1}, []byte{2, IAC, 3})
+	if exp := []byte{1, 2, IAC, IAC, 3}; !bytes.Equal(got, exp) {
+		t.Errorf("got %v, want %v", got, exp)
+	}
+
+	got = Subnegotiation(ComPortOption, SetBaudrate, 0, 0, 0x25, IAC)
+	if exp := []byte{IAC, SB, ComPortOption, SetBaudrate, 0, 0, 0x25, IAC, IAC, IAC, SE}; !bytes.Equal(got, exp) {
+		t.Errorf("got %v, want %v", got, exp)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	o := Options{Local: []byte{Binary}, Remote: []byte{Binary, ComPortOption}}
+
+	expect := func(got []byte, exp ...byte) {
+		t.Helper()
+		if !bytes.Equal(got, exp) {
+			t.Errorf("got %v, want %v", got, exp)
+		}
+	}
+
+	expect(o.Request(nil), IAC, WILL, Binary, IAC, DO, Binary, IAC, DO, ComPortOption)
+	// requesting again does not repeat pending requests
+	expect(o.Request(nil))
+
+	// acknowledgements are not answered
+	expect(o.Handle(nil, DO, Binary))
+	expect(o.Handle(nil, WILL, Binary))
+	// refusals neither
+	expect(o.Handle(nil, WONT, ComPortOption))
+	if !o.LocalEnabled(Binary) || !o.RemoteEnabled(Binary) || o.RemoteEnabled(ComPortOption) {
+		t.Error("wrong option state after negotiation")
+	}
+
+	// the peer's own request is agreed to
+	expect(o.Handle(nil, WILL, ComPortOption), IAC, DO, ComPortOption)
+	expect(o.Handle(nil, WILL, ComPortOption))
+	// unsupported options are refused
+	expect(o.Handle(nil, DO, Echo), IAC, WONT, Echo)
+	expect(o.Handle(nil, WILL, SuppressGA), IAC, DONT, SuppressGA)
+	// disabling is acknowledged once
+	expect(o.Handle(nil, DONT, Binary), IAC, WONT, Binary)
+	expect(o.Handle(nil, DONT, Binary))
+}
@@ -0,0 +1,83 @@
+package sers
+
+import (
+	"fmt"
+)
+
+// Opener opens serial ports with additional options. The zero value opens
+// ports the same way Open does, without any kind of exclusivity.
+type Opener struct {
+	// Exclusive puts the port in exclusive mode with TIOCEXCL. Further
+	// attempts to open the port fail until it is closed, except for those
+	// of privileged processes. On Windows, ports are always opened
+	// exclusively.
+	Exclusive bool
+
+	// LockFile makes Open create a UUCP-style lock file such as
+	// /var/lock/LCK..ttyUSB0 containing the PID of the process. Lock files
+	// left behind by processes that no longer exist are removed. The lock
+	// file is removed again when the port is closed. Lock files only work
+	// if all programs using the port honour them. They are not supported on
+	// Windows.
+	LockFile bool
+
+	// LockDir is the directory holding the lock files. If empty, the
+	// platform's default is used, /var/lock on Linux and /var/spool/lock on
+	// OS X.
+	LockDir string
+}
+
+// ErrPortBusy is returned by Open if the port is held by another process.
+type ErrPortBusy struct {
+	// Device is the path of the port.
+	Device string
+
+	// PID is the process holding the port, 0 if it cannot be determined.
+	PID int
+}
+
+func (epb *ErrPortBusy) Error() string {
+	if epb.PID == 0 {
+		return fmt.Sprintf("serial port %s is busy", epb.Device)
+	}
+	return fmt.Sprintf("serial port %s is busy, held by PID %d", epb.Device, epb.PID)
+}
+
+// Open opens the serial port fn. On termios platforms, the returned
+// SerialPort also implements net.Conn, including working deadlines, and can be
+// converted with a type assertion.
+//
+// Instead of a device path, fn may also be a port selector as described for
+// PortSelector, such as "usb:0403:6001:serial=A12345", or a URL. The scheme
+// of a URL selects the driver that opens the port, see RegisterDriver. The
+// built-in schemes are:
+//
+//	file:///dev/ttyS0           the device at the path, like Open("/dev/ttyS0").
+//	                            The parameters exclusive and lock enable
+//	                            the options of Opener.
+//	tcp://host:port             a raw TCP connection, e.g. to ser2net. SetMode
+//	                            is only recorded, SetBreak is not supported.
+//	rfc2217://host:port         a port on an RFC 2217 server, see OpenRFC2217.
+//	loop://                     a loopback port, returning what is written.
+//	pty://                      the master of a new pseudo terminal, see
+//	                            OpenPTYPair. The port has a method
+//	                            SlavePath() string, which returns the path
+//	                            other programs can open.
+//
+// For all schemes, the parameter mode takes a modestring that is set through
+// SetModeStruct, and the parameters timeout and minread set the read
+// parameters, with the timeout given as a duration, e.g.
+// "file:///dev/ttyS0?mode=115200,8n1&timeout=500ms".
+func Open(fn string) (SerialPort, error) {
+	return Opener{}.Open(fn)
+}
+
+// Open opens the serial port fn, as described for the package level Open,
+// with the options set in o. For URLs, the options only apply to the file
+// scheme, where they are combined with the parameters exclusive and lock.
+func (o Opener) Open(fn string) (SerialPort, error) {
+	if isURL(fn) {
+		return o.openURL(fn)
+	}
+	return o.open(fn)
+}
@@ -0,0 +1,11 @@
+// +build darwin
+
+package sers
+
+const defaultLockDir = "/var/spool/lock"
+
+// busyPID would return the process that has the device fn open. OS X does
+// not offer a simple way to find out, so it always returns 0.
+func busyPID(fn string) int {
+	return 0
+}
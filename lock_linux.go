@@ -0,0 +1,46 @@
+// +build linux
+
+package sers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const defaultLockDir = "/var/lock"
+
+// busyPID looks for a process that has the device fn open. It returns 0 if
+// there is none or if it is not visible to us.
+func busyPID(fn string) int {
+	dev, err := os.Stat(fn)
+	if err != nil {
+		return 0
+	}
+
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		fddir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := ioutil.ReadDir(fddir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			fi, err := os.Stat(filepath.Join(fddir, fd.Name()))
+			if err == nil && os.SameFile(fi, dev) {
+				return pid
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,135 @@
+// +build darwin linux
+
+package sers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lock creates the UUCP lock file for the device fn and returns its path. A
+// lock file whose process no longer exists is considered stale and
+// replaced.
+func (o Opener) lock(fn string) (string, error) {
+	dir := o.LockDir
+	if dir == "" {
+		dir = defaultLockDir
+	}
+
+	// the lock file is named after the device node, not after any of the
+	// symlinks pointing to it.
+	dev, err := filepath.EvalSymlinks(fn)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %v", fn, err)
+	}
+	lock := filepath.Join(dir, "LCK.."+filepath.Base(dev))
+
+	// the lock file is written completely before being linked into place, so
+	// that others never see it without a PID.
+	tmp, err := ioutil.TempFile(dir, "LTMP.")
+	if err != nil {
+		return "", &Error{"creating lock file", err}
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = fmt.Fprintf(tmp, "%10d\n", os.Getpid())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return "", &Error{"creating lock file", err}
+	}
+
+	// one retry after removing a stale lock file
+	for i := 0; i < 2; i++ {
+		err = os.Link(tmp.Name(), lock)
+		if err == nil {
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return "", &Error{"creating lock file", err}
+		}
+
+		pid, alive, stale := lockHolder(lock)
+		if alive {
+			return "", &ErrPortBusy{Device: fn, PID: pid}
+		}
+		if stale == nil {
+			// gone already
+			continue
+		}
+		if err := removeStale(lock, tmp.Name()+".stale", stale); err != nil {
+			return "", err
+		}
+	}
+
+	return "", &ErrPortBusy{Device: fn}
+}
+
+// removeStale removes the lock file judged stale, described by stale. Another
+// process may have replaced it with its own lock file in the meantime, so
+// instead of removing it by name, it is renamed to aside, which is atomic,
+// and only removed if it is still the same file. Otherwise, it is put back.
+func removeStale(lock, aside string, stale os.FileInfo) error {
+	if err := os.Rename(lock, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return &Error{"removing stale lock file", err}
+	}
+	defer os.Remove(aside)
+
+	fi, err := os.Lstat(aside)
+	if err == nil && os.SameFile(fi, stale) {
+		return nil
+	}
+
+	// the lock file of an opener that has replaced the stale one in the
+	// meantime, which must stay.
+	if err := os.Link(aside, lock); err != nil && !os.IsExist(err) {
+		return &Error{"restoring lock file", err}
+	}
+	return nil
+}
+
+// lockHolder reads the PID from a lock file and checks whether that process
+// still exists. Lock files that cannot be parsed are considered stale. For
+// lock files that are not alive, fi describes the file that was read, or is
+// nil if it no longer exists.
+func lockHolder(lock string) (pid int, alive bool, fi os.FileInfo) {
+	f, err := os.Open(lock)
+	if err != nil {
+		// the lock file may have been removed in the meantime. If it could
+		// not be read for other reasons, it is better to leave it alone.
+		return 0, !os.IsNotExist(err), nil
+	}
+	defer f.Close()
+
+	fi, err = f.Stat()
+	if err != nil {
+		return 0, true, nil
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, true, nil
+	}
+
+	pid, err = strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, false, fi
+	}
+
+	// signal 0 only checks whether the process exists. EPERM means it
+	// does, but belongs to someone else.
+	err = syscall.Kill(pid, 0)
+	alive = err == nil || err == syscall.EPERM
+	return pid, alive, fi
+}
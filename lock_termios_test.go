@@ -0,0 +1,141 @@
+// +build darwin linux
+
+package sers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenerLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sers-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dev := filepath.Join(dir, "ttyTEST0")
+	if err := ioutil.WriteFile(dev, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "by-id-link")
+	if err := os.Symlink(dev, link); err != nil {
+		t.Fatal(err)
+	}
+
+	o := Opener{LockFile: true, LockDir: dir}
+	lockfile := filepath.Join(dir, "LCK..ttyTEST0")
+
+	lock, err := o.lock(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock != lockfile {
+		t.Fatalf("got lock file %q, want %q", lock, lockfile)
+	}
+	content, err := ioutil.ReadFile(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := fmt.Sprintf("%10d\n", os.Getpid()); string(content) != exp {
+		t.Errorf("lock file contains %q, want %q", content, exp)
+	}
+
+	// locked through the symlink as well
+	_, err = o.lock(link)
+	busy, ok := err.(*ErrPortBusy)
+	if !ok {
+		t.Fatalf("locking a locked port returned %v, want *ErrPortBusy", err)
+	}
+	if busy.PID != os.Getpid() {
+		t.Errorf("port reported busy by PID %d, want %d", busy.PID, os.Getpid())
+	}
+
+	// a process that has exited leaves a stale lock file
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, stale := range []string{
+		fmt.Sprintf("%10d\n", cmd.Process.Pid),
+		"garbage\n",
+		"",
+	} {
+		if err := ioutil.WriteFile(lockfile, []byte(stale), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := o.lock(dev); err != nil {
+			t.Errorf("taking over stale lock file with content %q: %v", stale, err)
+		}
+	}
+
+	// no temporary files left behind
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		for _, e := range entries {
+			t.Log(e.Name())
+		}
+		t.Errorf("found %d entries in lock directory, want 3", len(entries))
+	}
+}
+
+func TestRemoveStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sers-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lock := filepath.Join(dir, "LCK..ttyTEST0")
+	aside := filepath.Join(dir, "LTMP.test.stale")
+	write := func(content string) os.FileInfo {
+		t.Helper()
+		os.Remove(lock)
+		if err := ioutil.WriteFile(lock, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Lstat(lock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi
+	}
+
+	// the lock file judged stale is removed
+	stale := write("garbage\n")
+	if err := removeStale(lock, aside, stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(lock); !os.IsNotExist(err) {
+		t.Errorf("stale lock file still there: %v", err)
+	}
+
+	// another opener has replaced it after it was judged stale
+	// with its own, which existed before, like the temporary file in lock.
+	stale = write("garbage\n")
+	live := fmt.Sprintf("%10d\n", os.Getpid())
+	tmp := filepath.Join(dir, "LTMP.other")
+	if err := ioutil.WriteFile(tmp, []byte(live), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStale(lock, aside, stale); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(lock)
+	if err != nil || string(content) != live {
+		t.Errorf("lock file contains %q, %v after removing a stale one, want %q", content, err, live)
+	}
+	if _, err := os.Lstat(aside); !os.IsNotExist(err) {
+		t.Errorf("lock file left aside: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package sers
+
+import (
+	"context"
+	"sync"
+)
+
+// loopPort is a port whose output is connected to its input, opened
+// through loop:// URLs. It also loops back the modem lines, as a loopback
+// plug does: DTR drives DSR and DCD, RTS drives CTS.
+type loopPort struct {
+	rb *readBuffer
+
+	mu     sync.Mutex
+	mode   Mode
+	lines  ModemLine
+	closed bool
+}
+
+var (
+	_ ModemLines = (*loopPort)(nil)
+	_ Flusher    = (*loopPort)(nil)
+)
+
+func newLoopPort() *loopPort {
+	return &loopPort{
+		rb:    newReadBuffer(),
+		mode:  Mode{Baudrate: 9600, DataBits: 8, Parity: N, Stopbits: 1, Handshake: NO_HANDSHAKE},
+		lines: DTR | RTS,
+	}
+}
+
+func (lp *loopPort) Read(b []byte) (int, error) {
+	return lp.rb.read(b)
+}
+
+func (lp *loopPort) Write(b []byte) (int, error) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if lp.closed {
+		return 0, errPortClosed
+	}
+	lp.rb.put(b, nil)
+	return len(b), nil
+}
+
+func (lp *loopPort) Close() error {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.closed = true
+	lp.rb.put(nil, errPortClosed)
+	return nil
+}
+
+// SetMode only records the mode, which has no effect on the loop.
+func (lp *loopPort) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
+	mode := Mode{baudrate, databits, parity, stopbits, handshake}
+	if err := mode.check(); err != nil {
+		return err
+	}
+
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.mode = mode
+	return nil
+}
+
+func (lp *loopPort) GetMode() (Mode, error) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	return lp.mode, nil
+}
+
+func (lp *loopPort) SetReadParams(minread int, timeout float64) error {
+	return lp.rb.setReadParams(minread, timeout)
+}
+
+func (lp *loopPort) SetBreak(on bool) error {
+	return nil
+}
+
+func (lp *loopPort) SetDTR(on bool) error {
+	return lp.setLines(DTR, on)
+}
+
+func (lp *loopPort) SetRTS(on bool) error {
+	return lp.setLines(RTS, on)
+}
+
+func (lp *loopPort) SetModemLines(lines ModemLine) error {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.lines = lines & (DTR | RTS)
+	return nil
+}
+
+func (lp *loopPort) setLines(line ModemLine, on bool) error {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if on {
+		lp.lines |= line
+	} else {
+		lp.lines &^= line
+	}
+	return nil
+}
+
+func (lp *loopPort) GetModemLines() (ModemLine, error) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	return lp.lines | nullModem(lp.lines), nil
+}
+
+func (lp *loopPort) FlushInput() error {
+	lp.rb.flush()
+	return nil
+}
+
+// FlushOutput and Drain have nothing to do, written data is available to
+// be read right away.
+func (lp *loopPort) FlushOutput() error {
+	return nil
+}
+
+func (lp *loopPort) Drain(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,290 @@
+package sers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ModemLine is a set of modem control and status lines, represented as a bit
+// mask.
+type ModemLine int
+
+const (
+	DTR ModemLine = 1 << iota // data terminal ready, output
+	RTS                       // request to send, output
+	CTS                       // clear to send, input
+	DSR                       // data set ready, input
+	DCD                       // data carrier detect, input
+	RI                        // ring indicator, input
+)
+
+var modemLineNames = []struct {
+	line ModemLine
+	name string
+}{
+	{DTR, "DTR"},
+	{RTS, "RTS"},
+	{CTS, "CTS"},
+	{DSR, "DSR"},
+	{DCD, "DCD"},
+	{RI, "RI"},
+}
+
+// String returns the names of the lines in ml, separated by "|", as in
+// "DTR|CTS". The empty set is represented as "0".
+func (ml ModemLine) String() string {
+	if ml == 0 {
+		return "0"
+	}
+
+	var names []string
+	for _, n := range modemLineNames {
+		if ml&n.line != 0 {
+			names = append(names, n.name)
+			ml &^= n.line
+		}
+	}
+	if ml != 0 {
+		names = append(names, "0x"+strconv.FormatInt(int64(ml), 16))
+	}
+	return strings.Join(names, "|")
+}
+
+// ModemLines is implemented by serial ports that give access to the modem
+// control and status lines. The serial ports returned by Open implement it.
+//
+// Pseudo terminals do not have modem lines. For those opened through
+// OpenPTYPair, the lines are emulated as described there. Other ports whose
+// driver does not support modem lines return the driver's error.
+type ModemLines interface {
+	// SetDTR asserts DTR if on == true, otherwise it deasserts DTR.
+	SetDTR(on bool) error
+
+	// SetRTS asserts RTS if on == true, otherwise it deasserts RTS. While
+	// RTSCTS_HANDSHAKE is in effect, the driver may override the setting.
+	SetRTS(on bool) error
+
+	// SetModemLines sets DTR and RTS in one operation. Lines that are
+	// contained in lines are asserted, the others are deasserted. Lines
+	// other than DTR and RTS are ignored.
+	SetModemLines(lines ModemLine) error
+
+	// GetModemLines returns the set of currently asserted lines.
+	GetModemLines() (ModemLine, error)
+}
+
+// ModemWaiter is implemented by serial ports that can wait for changes of
+// their modem status lines. On Linux, the serial ports returned by Open
+// implement it. They watch the driver's transition counters, which are read
+// every 20ms rather than waited on with TIOCMIWAIT, since the latter cannot
+// be interrupted by Close. Short pulses, such as on RI, are still counted.
+type ModemWaiter interface {
+	ModemLines
+
+	// WaitModemChange blocks until at least one of the input lines CTS,
+	// DSR, DCD or RI that are contained in mask changes its state and
+	// returns the lines that did. Changes that happen before the call are
+	// not reported. The wait ends early if ctx is done, in which case
+	// ctx.Err() is returned, or if the port is closed.
+	WaitModemChange(ctx context.Context, mask ModemLine) (ModemLine, error)
+}
+
+// ModemEvent describes a change of the modem status lines.
+type ModemEvent struct {
+	// Changed contains the lines that changed state.
+	Changed ModemLine
+	// Lines is the set of asserted lines after the change.
+	Lines ModemLine
+	// Err is set if waiting for changes failed. It is the last event
+	// delivered.
+	Err error
+}
+
+// WatchModemLines waits for changes of the lines in mask on a separate
+// goroutine and delivers them on the returned channel. The channel is closed
+// once ctx is done or after an event with a non-nil Err has been delivered,
+// for example because the port has been closed.
+//
+// If the receiver falls behind, pending changes are merged into a single
+// event. Transitions of short pulses, such as those on RI, are reported even
+// if the state of the line has reverted by the time Lines is read.
+func WatchModemLines(ctx context.Context, mw ModemWaiter, mask ModemLine) <-chan ModemEvent {
+	ch := make(chan ModemEvent, 1)
+	go func() {
+		defer close(ch)
+		for {
+			changed, err := mw.WaitModemChange(ctx, mask)
+			if err != nil && ctx.Err() != nil {
+				return
+			}
+
+			ev := ModemEvent{Changed: changed, Err: err}
+			if err == nil {
+				ev.Lines, ev.Err = mw.GetModemLines()
+			}
+
+			// we are the only sender, so after taking out the pending
+			// event, there is room for the merged one.
+			select {
+			case ch <- ev:
+			default:
+				select {
+				case pending := <-ch:
+					ev.Changed |= pending.Changed
+				default:
+				}
+				ch <- ev
+			}
+
+			if ev.Err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// lineCounts counts the transitions of the input lines.
+type lineCounts struct {
+	cts, dsr, rng, dcd uint32
+}
+
+// changed returns the lines whose count differs between lc and since.
+func (lc lineCounts) changed(since lineCounts) ModemLine {
+	var lines ModemLine
+	if lc.cts != since.cts {
+		lines |= CTS
+	}
+	if lc.dsr != since.dsr {
+		lines |= DSR
+	}
+	if lc.dcd != since.dcd {
+		lines |= DCD
+	}
+	if lc.rng != since.rng {
+		lines |= RI
+	}
+	return lines
+}
+
+// softModem emulates the modem lines of ports that do not have them. Two
+// soft modems can be connected as if by a null modem cable, see connect.
+type softModem struct {
+	lock    sync.Mutex
+	lines   ModemLine
+	counts  lineCounts
+	changed chan struct{}
+
+	// peer receives the outputs of this modem. wire serializes passing them
+	// on, so that the peer sees changes in order.
+	peer *softModem
+	wire sync.Mutex
+}
+
+// connect wires a and b like a null modem cable does: DTR of one end drives
+// DSR and DCD of the other, RTS drives CTS.
+func connect(a, b *softModem) {
+	a.peer, b.peer = b, a
+}
+
+// nullModem returns the inputs driven by outputs at the other end of a null
+// modem cable.
+func nullModem(outputs ModemLine) ModemLine {
+	var inputs ModemLine
+	if outputs&DTR != 0 {
+		inputs |= DSR | DCD
+	}
+	if outputs&RTS != 0 {
+		inputs |= CTS
+	}
+	return inputs
+}
+
+// set asserts the lines in mask that are contained in lines and deasserts
+// the remaining ones in mask.
+func (sm *softModem) set(mask, lines ModemLine) {
+	const outputs = DTR | RTS
+
+	if sm.peer != nil && mask&outputs != 0 {
+		sm.wire.Lock()
+		defer sm.wire.Unlock()
+	}
+
+	now := sm.update(mask, lines)
+
+	// the peer is updated without holding our lock, as it may be setting
+	// its outputs at the same time.
+	if sm.peer != nil && mask&outputs != 0 {
+		sm.peer.update(DSR|DCD|CTS, nullModem(now))
+	}
+}
+
+// update changes the lines and returns the new state.
+func (sm *softModem) update(mask, lines ModemLine) ModemLine {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	old := sm.lines
+	sm.lines = sm.lines&^mask | lines&mask
+
+	toggled := old ^ sm.lines
+	if toggled == 0 {
+		return sm.lines
+	}
+	if toggled&CTS != 0 {
+		sm.counts.cts++
+	}
+	if toggled&DSR != 0 {
+		sm.counts.dsr++
+	}
+	if toggled&DCD != 0 {
+		sm.counts.dcd++
+	}
+	if toggled&RI != 0 {
+		sm.counts.rng++
+	}
+	if sm.changed != nil {
+		close(sm.changed)
+		sm.changed = nil
+	}
+	return sm.lines
+}
+
+func (sm *softModem) get() ModemLine {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.lines
+}
+
+// state returns the current transition counts together with a channel that
+// is closed on the next change.
+func (sm *softModem) state() (lineCounts, <-chan struct{}) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if sm.changed == nil {
+		sm.changed = make(chan struct{})
+	}
+	return sm.counts, sm.changed
+}
+
+// wait waits for a change of the lines in mask, like WaitModemChange.
+func (sm *softModem) wait(ctx context.Context, mask ModemLine, closed <-chan struct{}) (ModemLine, error) {
+	before, changed := sm.state()
+	for {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-closed:
+			return 0, errPortClosed
+		}
+
+		var now lineCounts
+		now, changed = sm.state()
+		if lines := now.changed(before) & mask; lines != 0 {
+			return lines, nil
+		}
+	}
+}
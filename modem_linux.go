@@ -0,0 +1,109 @@
+// +build linux
+
+package sers
+
+import (
+	"context"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var _ ModemWaiter = (*baseport)(nil)
+
+// serialIcounter is the kernel's struct serial_icounter_struct.
+type serialIcounter struct {
+	Cts, Dsr, Rng, Dcd int32
+	Rx, Tx             int32
+	Frame, Overrun     int32
+	Parity, Brk        int32
+	BufOverrun         int32
+	Reserved           [9]int32
+}
+
+func (bp *baseport) getIcount() (*serialIcounter, error) {
+	var ic serialIcounter
+	if err := bp.ioctl(syscall.TIOCGICOUNT, unsafe.Pointer(&ic)); err != nil {
+		return nil, err
+	}
+
+	return &ic, nil
+}
+
+// pollIcount is getIcount for WaitModemChange, which must not use the file
+// descriptor once the port has been closed.
+func (bp *baseport) pollIcount() (*serialIcounter, error) {
+	bp.closeLock.RLock()
+	defer bp.closeLock.RUnlock()
+
+	select {
+	case <-bp.closed:
+		return nil, errPortClosed
+	default:
+	}
+
+	ic, err := bp.getIcount()
+	if err != nil {
+		return nil, &Error{"ioctl: getting modem status counters", err}
+	}
+	return ic, nil
+}
+
+func (ic *serialIcounter) lineCounts() lineCounts {
+	return lineCounts{
+		cts: uint32(ic.Cts),
+		dsr: uint32(ic.Dsr),
+		rng: uint32(ic.Rng),
+		dcd: uint32(ic.Dcd),
+	}
+}
+
+// modemPollInterval is the interval at which WaitModemChange polls the
+// modem status counters.
+//
+// WaitModemChange does not use TIOCMIWAIT, which would avoid the polling,
+// because nothing ends it but a modem status change. Close cannot: the
+// blocked ioctl holds a reference to the file, so the tty stays open, and
+// signals do not help either, as the kernel restarts the ioctl for the
+// SA_RESTART handlers of the Go runtime. A wait abandoned on Close would
+// keep DTR and RTS up despite HUPCL and make exclusive re-opens fail until
+// the next change, which may never come.
+const modemPollInterval = 20 * time.Millisecond
+
+func (bp *baseport) WaitModemChange(ctx context.Context, mask ModemLine) (ModemLine, error) {
+	mask &= CTS | DSR | DCD | RI
+	if mask == 0 {
+		return 0, &ParameterError{"mask", "has to contain at least one of CTS, DSR, DCD or RI"}
+	}
+
+	if bp.pty {
+		return bp.softModem.wait(ctx, mask, bp.closed)
+	}
+
+	ic, err := bp.pollIcount()
+	if err != nil {
+		return 0, err
+	}
+	before := ic.lineCounts()
+
+	t := time.NewTicker(modemPollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-bp.closed:
+			return 0, errPortClosed
+		}
+
+		ic, err := bp.pollIcount()
+		if err != nil {
+			return 0, err
+		}
+		if lines := ic.lineCounts().changed(before) & mask; lines != 0 {
+			return lines, nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// +build linux
+
+package sers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openFDs returns the number of file descriptors of the process that refer
+// to fn.
+func openFDs(t *testing.T, fn string) int {
+	t.Helper()
+	entries, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot list file descriptors: %v", err)
+	}
+	n := 0
+	for _, e := range entries {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", e.Name()))
+		if err == nil && target == fn {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWaitModemChangeClose(t *testing.T) {
+	const dev = "/dev/ttyS0"
+
+	o := Opener{Exclusive: true}
+	sp, err := o.Open(dev)
+	if err != nil {
+		t.Skipf("cannot open %s: %v", dev, err)
+	}
+	mw := sp.(ModemWaiter)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := mw.WaitModemChange(context.Background(), CTS|DSR|DCD|RI)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		sp.Close()
+		t.Skipf("%s does not support waiting for modem changes: %v", dev, err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := sp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != errPortClosed {
+			t.Errorf("pending wait returned %v, want %v", err, errPortClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending wait did not return after Close")
+	}
+
+	if n := openFDs(t, dev); n != 0 {
+		t.Errorf("%d file descriptors still refer to %s after Close", n, dev)
+	}
+
+	sp, err = o.Open(dev)
+	if err != nil {
+		t.Fatalf("re-opening %s exclusively: %v", dev, err)
+	}
+	sp.Close()
+}
@@ -0,0 +1,114 @@
+// +build darwin linux
+
+package sers
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var _ ModemLines = (*baseport)(nil)
+
+var tiocmBits = []struct {
+	line ModemLine
+	bit  int32
+}{
+	{DTR, syscall.TIOCM_DTR},
+	{RTS, syscall.TIOCM_RTS},
+	{CTS, syscall.TIOCM_CTS},
+	{DSR, syscall.TIOCM_DSR},
+	{DCD, syscall.TIOCM_CAR},
+	{RI, syscall.TIOCM_RNG},
+}
+
+func linesToTIOCM(lines ModemLine) int32 {
+	var bits int32
+	for _, b := range tiocmBits {
+		if lines&b.line != 0 {
+			bits |= b.bit
+		}
+	}
+	return bits
+}
+
+func tiocmToLines(bits int32) ModemLine {
+	var lines ModemLine
+	for _, b := range tiocmBits {
+		if bits&b.bit != 0 {
+			lines |= b.line
+		}
+	}
+	return lines
+}
+
+func (bp *baseport) SetDTR(on bool) error {
+	return bp.setModemLine(DTR, on)
+}
+
+func (bp *baseport) SetRTS(on bool) error {
+	return bp.setModemLine(RTS, on)
+}
+
+func (bp *baseport) setModemLine(line ModemLine, on bool) error {
+	var (
+		op       uint = syscall.TIOCMBIC
+		opstring      = "clearing"
+		lines    ModemLine
+	)
+	if on {
+		op, opstring, lines = syscall.TIOCMBIS, "setting", line
+	}
+
+	if bp.pty {
+		bp.softModem.set(line, lines)
+		return nil
+	}
+
+	bits := linesToTIOCM(line)
+	err := bp.ioctl(op, unsafe.Pointer(&bits))
+	if err != nil {
+		return &Error{fmt.Sprintf("ioctl: %s %v", opstring, line), err}
+	}
+
+	return nil
+}
+
+func (bp *baseport) SetModemLines(lines ModemLine) error {
+	const outputs = DTR | RTS
+
+	if bp.pty {
+		bp.softModem.set(outputs, lines)
+		return nil
+	}
+
+	var bits int32
+	err := bp.ioctl(syscall.TIOCMGET, unsafe.Pointer(&bits))
+	if err != nil {
+		return &Error{"ioctl: getting modem lines", err}
+	}
+
+	bits &^= linesToTIOCM(outputs)
+	bits |= linesToTIOCM(lines & outputs)
+
+	err = bp.ioctl(syscall.TIOCMSET, unsafe.Pointer(&bits))
+	if err != nil {
+		return &Error{"ioctl: setting modem lines", err}
+	}
+
+	return nil
+}
+
+func (bp *baseport) GetModemLines() (ModemLine, error) {
+	if bp.pty {
+		return bp.softModem.get(), nil
+	}
+
+	var bits int32
+	err := bp.ioctl(syscall.TIOCMGET, unsafe.Pointer(&bits))
+	if err != nil {
+		return 0, &Error{"ioctl: getting modem lines", err}
+	}
+
+	return tiocmToLines(bits), nil
+}
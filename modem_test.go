@@ -0,0 +1,101 @@
+package sers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestModemLineString(t *testing.T) {
+	cases := []struct {
+		Lines ModemLine
+		Str   string
+	}{
+		{0, "0"},
+		{DTR, "DTR"},
+		{DTR | RTS | CTS | DSR | DCD | RI, "DTR|RTS|CTS|DSR|DCD|RI"},
+		{RTS | DCD, "RTS|DCD"},
+		{CTS | 0x100, "CTS|0x100"},
+	}
+
+	for i, c := range cases {
+		act := c.Lines.String()
+		if act != c.Str {
+			t.Errorf("case %d: got %q, expected %q", i, act, c.Str)
+		}
+	}
+}
+
+func TestSoftModemWait(t *testing.T) {
+	var sm softModem
+	closed := make(chan struct{})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		// not in the mask, must not end the wait
+		sm.set(DSR, DSR)
+		time.Sleep(10 * time.Millisecond)
+		sm.set(DCD|RI, DCD)
+	}()
+
+	lines, err := sm.wait(context.Background(), DCD|CTS, closed)
+	if err != nil {
+		t.Fatalf("wait returned error %v", err)
+	}
+	if lines != DCD {
+		t.Errorf("got changed lines %v, want %v", lines, DCD)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = sm.wait(ctx, CTS, closed)
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error %v after deadline, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(closed)
+	_, err = sm.wait(context.Background(), CTS, closed)
+	if err != errPortClosed {
+		t.Errorf("got error %v after close, want %v", err, errPortClosed)
+	}
+}
+
+// softWaiter is a ModemWaiter whose input lines are set by the test.
+type softWaiter struct {
+	softModem
+	closed chan struct{}
+}
+
+func (sw *softWaiter) SetDTR(on bool) error                { return nil }
+func (sw *softWaiter) SetRTS(on bool) error                { return nil }
+func (sw *softWaiter) SetModemLines(lines ModemLine) error { return nil }
+func (sw *softWaiter) GetModemLines() (ModemLine, error)   { return sw.get(), nil }
+
+func (sw *softWaiter) WaitModemChange(ctx context.Context, mask ModemLine) (ModemLine, error) {
+	return sw.wait(ctx, mask, sw.closed)
+}
+
+func TestWatchModemLines(t *testing.T) {
+	sw := &softWaiter{closed: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := WatchModemLines(ctx, sw, CTS|RI)
+	// give the watcher a chance to start waiting
+	time.Sleep(10 * time.Millisecond)
+
+	sw.set(CTS, CTS)
+	ev := <-events
+	if ev.Err != nil || ev.Changed != CTS || ev.Lines != CTS {
+		t.Errorf("got event %+v, want CTS change with CTS asserted", ev)
+	}
+
+	close(sw.closed)
+	ev = <-events
+	if ev.Err != errPortClosed {
+		t.Errorf("got event %+v, want error %v", ev, errPortClosed)
+	}
+	if _, ok := <-events; ok {
+		t.Errorf("event channel not closed after error")
+	}
+}
@@ -1,7 +1,11 @@
 package sers
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -14,9 +18,9 @@ import (
 // Any or all of the three components can be left out. Non-specified parts will
 // take the default values mentioned before.
 //
-// Valid choices for databits are [5, 6, 7, 8], for parity it is [n, o, e] and
-// for stopbits it's [1, 2]. Valid choices for the handshake parts are "", "none"
-// and "rtscts". The function is not case sensitive.
+// Valid choices for databits are [5, 6, 7, 8], for parity it is [n, o, e, m, s] and
+// for stopbits it's [1, 2]. Valid choices for the handshake parts are "", "none",
+// "rtscts", "xonxoff" and "rs485". The function is not case sensitive.
 //
 // A couple of examples:
 //
@@ -25,6 +29,9 @@ import (
 // 		57600,8o1,rtscts - 57600 baud, 8 data bits, odd parity, 1 stopbit, rts/cts handshake
 //		19200,72		 - 19200 baud, 7 data bits, no parity, 2 stop bits, no handshake
 //		9600,2,rtscts    - 9600 baud, 8 data bits, no parity, 2 stop bits, rts/cts handshake
+//		4800,7e1,xonxoff - 4800 baud, 7 data bits, even parity, 1 stopbit, xon/xoff handshake
+//		9600,8m1         - 9600 baud, 8 data bits, mark parity, 1 stopbit, no handshake
+//		19200,8e1,rs485  - 19200 baud, 8 data bits, even parity, 1 stopbit, rs-485 mode
 func ParseModestring(s string) (Mode, error) {
 	var mode Mode
 
@@ -74,6 +81,12 @@ func ParseModestring(s string) (Mode, error) {
 			case 'E':
 				mode.Parity = E
 				idx++
+			case 'M':
+				mode.Parity = M
+				idx++
+			case 'S':
+				mode.Parity = S
+				idx++
 			}
 		}
 
@@ -101,6 +114,10 @@ func ParseModestring(s string) (Mode, error) {
 			mode.Handshake = NO_HANDSHAKE
 		case "RTSCTS":
 			mode.Handshake = RTSCTS_HANDSHAKE
+		case "XONXOFF":
+			mode.Handshake = XONXOFF_HANDSHAKE
+		case "RS485":
+			mode.Handshake = RS485_HANDSHAKE
 		default:
 			return mode, fmt.Errorf("cannot parse serial modestring %q: unknown handshake format %q", s, hspart)
 		}
@@ -108,3 +125,115 @@ func ParseModestring(s string) (Mode, error) {
 
 	return mode, nil
 }
+
+// FormatModestring returns the canonical modestring of m, which names all
+// parts, e.g. "115200,8n1,none" or "4800,7e1,xonxoff". ParseModestring turns
+// it back into m. An error is returned if m is not valid.
+func FormatModestring(m Mode) (string, error) {
+	if !m.Valid() || uint64(m.Baudrate) > math.MaxUint32 {
+		return "", &ParameterError{"mode", fmt.Sprintf("invalid mode (%d,%d,%d,%d,%d)",
+			m.Baudrate, m.DataBits, m.Parity, m.Stopbits, m.Handshake)}
+	}
+
+	parstring := ""
+	switch m.Parity {
+	case N:
+		parstring = "n"
+	case O:
+		parstring = "o"
+	case E:
+		parstring = "e"
+	case M:
+		parstring = "m"
+	case S:
+		parstring = "s"
+	}
+
+	hsstring := ""
+	switch m.Handshake {
+	case NO_HANDSHAKE:
+		hsstring = "none"
+	case RTSCTS_HANDSHAKE:
+		hsstring = "rtscts"
+	case XONXOFF_HANDSHAKE:
+		hsstring = "xonxoff"
+	case RS485_HANDSHAKE:
+		hsstring = "rs485"
+	}
+
+	return fmt.Sprintf("%d,%d%s%d,%s",
+		m.Baudrate,
+		m.DataBits,
+		parstring,
+		m.Stopbits,
+		hsstring), nil
+}
+
+// MarshalText implements encoding.TextMarshaler. The text is the canonical
+// modestring returned by FormatModestring, so modes appear as strings such
+// as "115200,8n1,none" in JSON, YAML or TOML. The zero Mode, which usually
+// stands for a mode that has not been configured, is encoded as "".
+func (m Mode) MarshalText() ([]byte, error) {
+	if m == (Mode{}) {
+		return []byte{}, nil
+	}
+	s, err := FormatModestring(m)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts all
+// modestrings understood by ParseModestring, and "", which results in the
+// zero Mode.
+func (m *Mode) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*m = Mode{}
+		return nil
+	}
+	mode, err := ParseModestring(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Besides modestrings, it accepts
+// the objects with the fields Baudrate, DataBits, Parity, Stopbits and
+// Handshake that encoding/json produced before Mode implemented
+// encoding.TextMarshaler, so that existing configuration files keep working.
+func (m *Mode) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '{':
+		// modeFields has the fields of Mode, but none of its methods.
+		type modeFields Mode
+		return json.Unmarshal(data, (*modeFields)(m))
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return m.UnmarshalText([]byte(s))
+}
+
+// Set parses the modestring s into m. Together with String, it makes *Mode
+// a flag.Value, so that it can be used with flag.Var and FlagSet.Var.
+func (m *Mode) Set(s string) error {
+	return m.UnmarshalText([]byte(s))
+}
+
+// ModeVar defines a flag of the command line flag set with the given name
+// and usage, which takes a modestring and stores the mode in m. value is
+// the default modestring. ModeVar panics if value cannot be parsed.
+func ModeVar(m *Mode, name string, value string, usage string) {
+	if err := m.Set(value); err != nil {
+		panic("sers: ModeVar default: " + err.Error())
+	}
+	flag.Var(m, name, usage)
+}
@@ -1,6 +1,10 @@
 package sers
 
-import "testing"
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+)
 
 func TestParseModestring(t *testing.T) {
 	cases := []struct {
@@ -38,6 +42,18 @@ func TestParseModestring(t *testing.T) {
 		{"54,8n1,invalid", false, Mode{}},
 		// all default framing format
 		{"66,,rtscts", true, Mode{66, 8, N, 1, RTSCTS_HANDSHAKE}},
+		// software handshake
+		{"4800,7e1,xonxoff", true, Mode{4800, 7, E, 1, XONXOFF_HANDSHAKE}},
+		// not case sensitive
+		{"9600,8N1,XonXoff", true, Mode{9600, 8, N, 1, XONXOFF_HANDSHAKE}},
+		// mark parity
+		{"9600,8m1", true, Mode{9600, 8, M, 1, NO_HANDSHAKE}},
+		// space parity, stop bits left at default
+		{"19200,7S", true, Mode{19200, 7, S, 1, NO_HANDSHAKE}},
+		// kernel rs-485 mode
+		{"19200,8e1,rs485", true, Mode{19200, 8, E, 1, RS485_HANDSHAKE}},
+		// only one parity setting
+		{"19200,7ms1", false, Mode{}},
 	}
 
 	for i, c := range cases {
@@ -72,6 +88,11 @@ func TestModestringStringMethod(t *testing.T) {
 		{Mode{4800, 6, N, 1, NO_HANDSHAKE}, "4800,6n1,none"},
 		{Mode{9600, 7, O, 2, RTSCTS_HANDSHAKE}, "9600,7o2,rtscts"},
 		{Mode{19200, 8, N, 1, NO_HANDSHAKE}, "19200,8n1,none"},
+		{Mode{4800, 7, E, 1, XONXOFF_HANDSHAKE}, "4800,7e1,xonxoff"},
+		{Mode{9600, 8, M, 1, NO_HANDSHAKE}, "9600,8m1,none"},
+		{Mode{9600, 8, S, 2, RTSCTS_HANDSHAKE}, "9600,8s2,rtscts"},
+		{Mode{19200, 8, E, 1, RS485_HANDSHAKE}, "19200,8e1,rs485"},
+		{Mode{4800, 7, E, 1, 4}, "invalid_mode(4800,7,1,1,4)"},
 	}
 
 	for i, c := range cases {
@@ -83,3 +104,120 @@ func TestModestringStringMethod(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatModestringRoundTrip(t *testing.T) {
+	for _, br := range []int{0, 50, 9600, 115200, 4000000, 1<<31 - 1} {
+		for db := 5; db <= 8; db++ {
+			for _, par := range []int{N, O, E, M, S} {
+				for sb := 1; sb <= 2; sb++ {
+					for _, hs := range []int{NO_HANDSHAKE, RTSCTS_HANDSHAKE, XONXOFF_HANDSHAKE, RS485_HANDSHAKE} {
+						mode := Mode{br, db, par, sb, hs}
+						s, err := FormatModestring(mode)
+						if err != nil {
+							t.Errorf("FormatModestring(%#v): %v", mode, err)
+							continue
+						}
+						parsed, err := ParseModestring(s)
+						if err != nil || parsed != mode {
+							t.Errorf("ParseModestring(%q) = %v, %v, want %#v", s, parsed, err, mode)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, mode := range []Mode{
+		{},
+		{-1, 8, N, 1, NO_HANDSHAKE},
+		{9600, 9, N, 1, NO_HANDSHAKE},
+		{9600, 8, 'X', 1, NO_HANDSHAKE},
+		{9600, 8, N, 3, NO_HANDSHAKE},
+		{9600, 8, N, 1, 17},
+	} {
+		if s, err := FormatModestring(mode); err == nil {
+			t.Errorf("FormatModestring(%#v) = %q, want error", mode, s)
+		}
+		// the zero Mode is marshalled as "", see TestModeJSON
+		if _, err := mode.MarshalText(); err == nil && mode != (Mode{}) {
+			t.Errorf("MarshalText of %#v succeeded", mode)
+		}
+	}
+}
+
+func TestModeJSON(t *testing.T) {
+	type config struct {
+		Port string
+		Mode Mode
+	}
+
+	c := config{"/dev/ttyUSB0", Mode{57600, 7, E, 2, XONXOFF_HANDSHAKE}}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"Port":"/dev/ttyUSB0","Mode":"57600,7e2,xonxoff"}`; string(b) != exp {
+		t.Errorf("got %s, want %s", b, exp)
+	}
+
+	var back config
+	if err := json.Unmarshal(b, &back); err != nil || back != c {
+		t.Errorf("unmarshalled %v, %v, want %v", back, err, c)
+	}
+
+	// shorthand modestrings are accepted, too
+	if err := json.Unmarshal([]byte(`{"Mode":"9600"}`), &back); err != nil || back.Mode != (Mode{9600, 8, N, 1, NO_HANDSHAKE}) {
+		t.Errorf("unmarshalled %v, %v", back.Mode, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Mode":"9600,8x1"}`), &back); err == nil {
+		t.Error("unmarshalling an invalid modestring succeeded")
+	}
+
+	// the zero Mode, i.e. no mode configured, is encoded as ""
+	b, err = json.Marshal(config{Port: "/dev/ttyUSB0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"Port":"/dev/ttyUSB0","Mode":""}`; string(b) != exp {
+		t.Errorf("got %s, want %s", b, exp)
+	}
+	back = c
+	if err := json.Unmarshal(b, &back); err != nil || back.Mode != (Mode{}) {
+		t.Errorf("unmarshalled %v, %v, want the zero Mode", back.Mode, err)
+	}
+
+	// configuration files written before Mode was encoded as a modestring
+	old := `{"Port":"/dev/ttyUSB0","Mode":{"Baudrate":57600,"DataBits":7,"Parity":1,"Stopbits":2,"Handshake":2}}`
+	back = config{}
+	if err := json.Unmarshal([]byte(old), &back); err != nil || back != c {
+		t.Errorf("unmarshalled %v, %v, want %v", back, err, c)
+	}
+}
+
+func TestModeFlag(t *testing.T) {
+	// ModeVar works on the command line flag set, which the test must not
+	// leave modified.
+	defer func(cl *flag.FlagSet) { flag.CommandLine = cl }(flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet("sers.test", flag.ContinueOnError)
+
+	var m Mode
+	ModeVar(&m, "sers-test-mode", "115200,8n1", "serial port mode")
+	if exp := (Mode{115200, 8, N, 1, NO_HANDSHAKE}); m != exp {
+		t.Errorf("default mode %v, want %v", m, exp)
+	}
+	if err := flag.Set("sers-test-mode", "4800,7e1,rtscts"); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (Mode{4800, 7, E, 1, RTSCTS_HANDSHAKE}); m != exp {
+		t.Errorf("mode %v after setting the flag, want %v", m, exp)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&m, "mode", "serial port mode")
+	if err := fs.Parse([]string{"-mode", "9600,8o2"}); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (Mode{9600, 8, O, 2, NO_HANDSHAKE}); m != exp {
+		t.Errorf("mode %v after parsing, want %v", m, exp)
+	}
+}
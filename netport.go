@@ -0,0 +1,100 @@
+package sers
+
+import (
+	"net"
+	"sync"
+)
+
+// netPort is a serial port at the other end of a raw TCP connection, such
+// as one served by ser2net in raw mode or by the bridge package. The server
+// configures the port, so the mode set through SetMode is only recorded.
+type netPort struct {
+	conn   net.Conn
+	rb     *readBuffer
+	closed chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	mode    Mode
+	modeSet bool
+}
+
+func newNetPort(conn net.Conn) *netPort {
+	np := &netPort{
+		conn:   conn,
+		rb:     newReadBuffer(),
+		closed: make(chan struct{}),
+	}
+	go np.receive()
+	return np
+}
+
+func (np *netPort) receive() {
+	p := make([]byte, 1024)
+	for {
+		n, err := np.conn.Read(p)
+		if err != nil {
+			select {
+			case <-np.closed:
+				err = errPortClosed
+			default:
+				err = &Error{"tcp connection", err}
+			}
+		}
+		np.rb.put(p[:n], err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (np *netPort) Read(b []byte) (int, error) {
+	return np.rb.read(b)
+}
+
+func (np *netPort) Write(b []byte) (int, error) {
+	select {
+	case <-np.closed:
+		return 0, errPortClosed
+	default:
+	}
+	return np.conn.Write(b)
+}
+
+func (np *netPort) Close() error {
+	np.once.Do(func() {
+		close(np.closed)
+		np.conn.Close()
+	})
+	return nil
+}
+
+// SetMode records the mode for GetMode, it has no effect on the port.
+func (np *netPort) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
+	mode := Mode{baudrate, databits, parity, stopbits, handshake}
+	if err := mode.check(); err != nil {
+		return err
+	}
+
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	np.mode, np.modeSet = mode, true
+	return nil
+}
+
+func (np *netPort) GetMode() (Mode, error) {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	if !np.modeSet {
+		return Mode{}, StringError("sers: the mode of a raw TCP port is unknown until it has been set through SetMode")
+	}
+	return np.mode, nil
+}
+
+func (np *netPort) SetReadParams(minread int, timeout float64) error {
+	return np.rb.setReadParams(minread, timeout)
+}
+
+func (np *netPort) SetBreak(on bool) error {
+	return StringError("break conditions are not supported on raw TCP ports")
+}
@@ -0,0 +1,74 @@
+package sers
+
+// PortInfo describes a serial port found by ListPorts.
+type PortInfo struct {
+	// Device is the path of the device node, e.g. "/dev/ttyUSB0". It can
+	// be passed to Open.
+	Device string
+
+	// Name is the kernel's name of the port, e.g. "ttyUSB0".
+	Name string
+
+	// Driver is the name of the kernel driver serving the port, e.g.
+	// "ftdi_sio" or "cdc_acm".
+	Driver string
+
+	// Bus is the bus the underlying device is attached to, e.g. "usb",
+	// "pci" or "pnp".
+	Bus string
+
+	// The following fields are only filled in for USB devices. Interface
+	// is the number of the USB interface the port belongs to, which tells
+	// apart the ports of multi-port adapters.
+	VID          uint16
+	PID          uint16
+	SerialNumber string
+	Manufacturer string
+	Product      string
+	Interface    int
+
+	// ByID and ByPath contain the stable symlinks to the device node that
+	// udev maintains in /dev/serial/by-id and /dev/serial/by-path.
+	ByID   []string
+	ByPath []string
+}
+
+// IsUSB reports whether the port belongs to a USB device.
+func (pi *PortInfo) IsUSB() bool {
+	return pi.Bus == "usb"
+}
+
+// PortLister enumerates the serial ports of a system. The zero value
+// examines the system's /sys and /dev. Other roots can be configured, which
+// allows working on a copy of these trees.
+//
+// Enumeration is currently only supported on Linux.
+type PortLister struct {
+	// SysfsRoot is the mount point of sysfs, "/sys" if empty.
+	SysfsRoot string
+
+	// DevRoot is the directory containing the device nodes, "/dev" if
+	// empty.
+	DevRoot string
+}
+
+// ListPorts returns the serial ports present on the system, sorted by
+// device path. Virtual terminals and other ttys that are not backed by
+// hardware are skipped.
+func ListPorts() ([]PortInfo, error) {
+	return PortLister{}.List()
+}
+
+func (pl PortLister) sysfsRoot() string {
+	if pl.SysfsRoot == "" {
+		return "/sys"
+	}
+	return pl.SysfsRoot
+}
+
+func (pl PortLister) devRoot() string {
+	if pl.DevRoot == "" {
+		return "/dev"
+	}
+	return pl.DevRoot
+}
@@ -0,0 +1,157 @@
+// +build linux
+
+package sers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// List returns the serial ports present on the system, sorted by device
+// path. Virtual terminals and other ttys that are not backed by hardware are
+// skipped.
+func (pl PortLister) List() ([]PortInfo, error) {
+	classdir := filepath.Join(pl.sysfsRoot(), "class", "tty")
+	entries, err := ioutil.ReadDir(classdir)
+	if err != nil {
+		return nil, &Error{"listing serial ports", err}
+	}
+
+	links := pl.serialLinks()
+
+	var ports []PortInfo
+	for _, e := range entries {
+		pi, ok := pl.portInfo(filepath.Join(classdir, e.Name()))
+		if !ok {
+			continue
+		}
+		pi.ByID = links["by-id"][pi.Name]
+		pi.ByPath = links["by-path"][pi.Name]
+		ports = append(ports, pi)
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Device < ports[j].Device
+	})
+
+	return ports, nil
+}
+
+// portInfo examines the sysfs directory of a tty. It returns false if the
+// tty is not backed by hardware.
+func (pl PortLister) portInfo(ttydir string) (PortInfo, bool) {
+	name := filepath.Base(ttydir)
+	pi := PortInfo{
+		Device:    filepath.Join(pl.devRoot(), name),
+		Name:      name,
+		Interface: -1,
+	}
+
+	// virtual terminals, ptys and the like have no device.
+	devdir, err := filepath.EvalSymlinks(filepath.Join(ttydir, "device"))
+	if err != nil {
+		return pi, false
+	}
+
+	// since linux 6.5, the serial core puts controller and port devices
+	// of its own between the tty and the hardware.
+	subsystem := linkBase(filepath.Join(devdir, "subsystem"))
+	for subsystem == "serial-base" {
+		devdir = filepath.Dir(devdir)
+		subsystem = linkBase(filepath.Join(devdir, "subsystem"))
+	}
+
+	// the 8250 driver registers ttyS ports whether they are present or
+	// not. the ones that are not have the platform device as parent.
+	if filepath.Base(devdir) == "serial8250" {
+		return pi, false
+	}
+
+	pi.Driver = linkBase(filepath.Join(devdir, "driver"))
+	pi.Bus = subsystem
+
+	var ifdir string
+	switch subsystem {
+	case "usb-serial":
+		// ttyUSB: the device is the port of a usb-serial driver,
+		// a child of the USB interface.
+		ifdir = filepath.Dir(devdir)
+	case "usb":
+		// ttyACM: the device is the USB interface itself.
+		ifdir = devdir
+	default:
+		return pi, true
+	}
+
+	pi.Bus = "usb"
+	if pi.Driver == "" {
+		pi.Driver = linkBase(filepath.Join(ifdir, "driver"))
+	}
+	if n, err := strconv.ParseInt(readAttr(ifdir, "bInterfaceNumber"), 16, 32); err == nil {
+		pi.Interface = int(n)
+	}
+
+	usbdir := filepath.Dir(ifdir)
+	if v, err := strconv.ParseUint(readAttr(usbdir, "idVendor"), 16, 16); err == nil {
+		pi.VID = uint16(v)
+	}
+	if p, err := strconv.ParseUint(readAttr(usbdir, "idProduct"), 16, 16); err == nil {
+		pi.PID = uint16(p)
+	}
+	pi.SerialNumber = readAttr(usbdir, "serial")
+	pi.Manufacturer = readAttr(usbdir, "manufacturer")
+	pi.Product = readAttr(usbdir, "product")
+
+	return pi, true
+}
+
+// serialLinks maps the names of ttys to the symlinks pointing to them in
+// /dev/serial/by-id and /dev/serial/by-path.
+func (pl PortLister) serialLinks() map[string]map[string][]string {
+	links := make(map[string]map[string][]string)
+	for _, kind := range []string{"by-id", "by-path"} {
+		links[kind] = make(map[string][]string)
+
+		dir := filepath.Join(pl.devRoot(), "serial", kind)
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			link := filepath.Join(dir, e.Name())
+			name := linkBase(link)
+			if name == "" {
+				continue
+			}
+			links[kind][name] = append(links[kind][name], link)
+		}
+	}
+	return links
+}
+
+// linkBase returns the last element of the target of the symlink at path or
+// "" if path is not a symlink.
+func linkBase(path string) string {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// readAttr returns the trimmed contents of a sysfs attribute or "" if it can
+// not be read.
+func readAttr(dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
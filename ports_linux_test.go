@@ -0,0 +1,212 @@
+package sers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeTree builds a directory tree from a description. Entries with a
+// target starting with "->" become symlinks, all others files with the given
+// contents. Directories are created as needed. Link targets are relative to
+// root.
+func fakeTree(t *testing.T, root string, entries map[string]string) {
+	for path, content := range entries {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if len(content) >= 2 && content[:2] == "->" {
+			if err := os.Symlink(filepath.Join(root, content[2:]), full); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPortListerList(t *testing.T) {
+	root, err := ioutil.TempDir("", "sers-ports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	const (
+		ftdi = "sys/devices/pci0000:00/0000:00:14.0/usb1/1-2"
+		acm  = "sys/devices/pci0000:00/0000:00:14.0/usb1/1-3"
+	)
+
+	fakeTree(t, root, map[string]string{
+		// FTDI adapter, served by a usb-serial driver
+		ftdi + "/idVendor":                      "0403\n",
+		ftdi + "/idProduct":                     "6001\n",
+		ftdi + "/serial":                        "A12345\n",
+		ftdi + "/manufacturer":                  "FTDI\n",
+		ftdi + "/product":                       "FT232R USB UART\n",
+		ftdi + "/1-2:1.0/bInterfaceNumber":      "00\n",
+		ftdi + "/1-2:1.0/driver":                "->sys/bus/usb/drivers/ftdi_sio",
+		ftdi + "/1-2:1.0/ttyUSB0/driver":        "->sys/bus/usb-serial/drivers/ftdi_sio",
+		ftdi + "/1-2:1.0/ttyUSB0/subsystem":     "->sys/bus/usb-serial",
+		"sys/class/tty/ttyUSB0/device":          "->" + ftdi + "/1-2:1.0/ttyUSB0",
+		"dev/serial/by-id/usb-FTDI_A12345-port": "->dev/ttyUSB0",
+		"dev/serial/by-path/pci-usb-0:2:1.0":    "->dev/ttyUSB0",
+
+		// CDC ACM device, second interface
+		acm + "/idVendor":                 "2341\n",
+		acm + "/idProduct":                "0043\n",
+		acm + "/product":                  "Arduino Uno\n",
+		acm + "/1-3:1.2/bInterfaceNumber": "02\n",
+		acm + "/1-3:1.2/driver":           "->sys/bus/usb/drivers/cdc_acm",
+		acm + "/1-3:1.2/subsystem":        "->sys/bus/usb",
+		"sys/class/tty/ttyACM0/device":    "->" + acm + "/1-3:1.2",
+
+		// built-in serial port
+		"sys/devices/pnp0/00:05/driver":    "->sys/bus/pnp/drivers/serial",
+		"sys/devices/pnp0/00:05/subsystem": "->sys/bus/pnp",
+		"sys/class/tty/ttyS0/device":       "->sys/devices/pnp0/00:05",
+
+		// 8250 placeholder without hardware
+		"sys/devices/platform/serial8250/subsystem": "->sys/bus/platform",
+		"sys/class/tty/ttyS1/device":                "->sys/devices/platform/serial8250",
+
+		// built-in serial port, as presented by linux >= 6.5
+		"sys/devices/pnp0/00:06/driver":                      "->sys/bus/pnp/drivers/serial",
+		"sys/devices/pnp0/00:06/subsystem":                   "->sys/bus/pnp",
+		"sys/devices/pnp0/00:06/00:06:0/subsystem":           "->sys/bus/serial-base",
+		"sys/devices/pnp0/00:06/00:06:0/00:06:0.0/driver":    "->sys/bus/serial-base/drivers/port",
+		"sys/devices/pnp0/00:06/00:06:0/00:06:0.0/subsystem": "->sys/bus/serial-base",
+		"sys/class/tty/ttyS2/device":                         "->sys/devices/pnp0/00:06/00:06:0/00:06:0.0",
+
+		// 8250 placeholder, as presented by linux >= 6.5
+		"sys/devices/platform/serial8250/serial8250:0/subsystem":                "->sys/bus/serial-base",
+		"sys/devices/platform/serial8250/serial8250:0/serial8250:0.3/subsystem": "->sys/bus/serial-base",
+		"sys/class/tty/ttyS3/device":                                            "->sys/devices/platform/serial8250/serial8250:0/serial8250:0.3",
+
+		// virtual terminal
+		"sys/class/tty/tty0/dev": "4:0\n",
+	})
+
+	pl := PortLister{
+		SysfsRoot: filepath.Join(root, "sys"),
+		DevRoot:   filepath.Join(root, "dev"),
+	}
+	ports, err := pl.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := filepath.Join(root, "dev")
+	exp := []PortInfo{
+		{
+			Device:    filepath.Join(dev, "ttyACM0"),
+			Name:      "ttyACM0",
+			Driver:    "cdc_acm",
+			Bus:       "usb",
+			VID:       0x2341,
+			PID:       0x0043,
+			Product:   "Arduino Uno",
+			Interface: 2,
+		},
+		{
+			Device:    filepath.Join(dev, "ttyS0"),
+			Name:      "ttyS0",
+			Driver:    "serial",
+			Bus:       "pnp",
+			Interface: -1,
+		},
+		{
+			Device:    filepath.Join(dev, "ttyS2"),
+			Name:      "ttyS2",
+			Driver:    "serial",
+			Bus:       "pnp",
+			Interface: -1,
+		},
+		{
+			Device:       filepath.Join(dev, "ttyUSB0"),
+			Name:         "ttyUSB0",
+			Driver:       "ftdi_sio",
+			Bus:          "usb",
+			VID:          0x0403,
+			PID:          0x6001,
+			SerialNumber: "A12345",
+			Manufacturer: "FTDI",
+			Product:      "FT232R USB UART",
+			Interface:    0,
+			ByID:         []string{filepath.Join(dev, "serial/by-id/usb-FTDI_A12345-port")},
+			ByPath:       []string{filepath.Join(dev, "serial/by-path/pci-usb-0:2:1.0")},
+		},
+	}
+
+	if !reflect.DeepEqual(ports, exp) {
+		t.Errorf("got ports\n%+v\nwant\n%+v", ports, exp)
+	}
+}
+
+func TestPortListerResolve(t *testing.T) {
+	root, err := ioutil.TempDir("", "sers-ports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	entries := map[string]string{}
+	for i, serial := range []string{"A12345", "B67890"} {
+		n := fmt.Sprint(i + 2)
+		usb := "sys/devices/pci0000:00/0000:00:14.0/usb1/1-" + n
+		intf := usb + "/1-" + n + ":1.0"
+		tty := "ttyUSB" + fmt.Sprint(i)
+		entries[usb+"/idVendor"] = "0403\n"
+		entries[usb+"/idProduct"] = "6001\n"
+		entries[usb+"/serial"] = serial + "\n"
+		entries[intf+"/bInterfaceNumber"] = "00\n"
+		entries[intf+"/"+tty+"/driver"] = "->sys/bus/usb-serial/drivers/ftdi_sio"
+		entries[intf+"/"+tty+"/subsystem"] = "->sys/bus/usb-serial"
+		entries["sys/class/tty/"+tty+"/device"] = "->" + intf + "/" + tty
+		entries["dev/serial/by-path/pci-0000:00:14.0-usb-0:"+n+":1.0-port0"] = "->dev/" + tty
+	}
+	fakeTree(t, root, entries)
+
+	pl := PortLister{
+		SysfsRoot: filepath.Join(root, "sys"),
+		DevRoot:   filepath.Join(root, "dev"),
+	}
+	dev := filepath.Join(root, "dev")
+
+	for _, tc := range []struct {
+		selector string
+		device   string
+		matches  int
+	}{
+		{"usb:0403:6001:serial=A12345", filepath.Join(dev, "ttyUSB0"), 1},
+		{"usb:serial=B67890", filepath.Join(dev, "ttyUSB1"), 1},
+		{"usb:by-path=pci-0000:00:14.0-usb-0:3:1.0-port0", filepath.Join(dev, "ttyUSB1"), 1},
+		{"usb:by-path=/dev/serial/by-path/pci-0000:00:14.0-usb-0:2:1.0-port0", filepath.Join(dev, "ttyUSB0"), 1},
+		{"usb:0403:6001", "", 2},
+		{"usb:0403:6010", "", 0},
+		{"usb:0403:6001:interface=1", "", 0},
+	} {
+		device, err := pl.Resolve(tc.selector)
+		if tc.device != "" {
+			if err != nil || device != tc.device {
+				t.Errorf("Resolve(%q) = %q, %v, want %q", tc.selector, device, err, tc.device)
+			}
+			continue
+		}
+
+		se, ok := err.(*SelectorError)
+		if !ok {
+			t.Errorf("Resolve(%q) = %q, %v, want *SelectorError", tc.selector, device, err)
+			continue
+		}
+		if len(se.Matches) != tc.matches {
+			t.Errorf("Resolve(%q) matched %d ports, want %d: %v", tc.selector, len(se.Matches), tc.matches, err)
+		}
+	}
+}
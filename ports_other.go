@@ -0,0 +1,9 @@
+// +build !linux
+
+package sers
+
+// List returns the serial ports present on the system. It is not supported
+// on this platform.
+func (pl PortLister) List() ([]PortInfo, error) {
+	return nil, StringError("listing serial ports is not supported on this platform")
+}
@@ -0,0 +1,26 @@
+package sers
+
+// PTYPair is a pair of connected pseudo terminal ends, as returned by
+// OpenPTYPair. Whatever is written to one end can be read from the other,
+// which makes it a stand-in for a serial port and the device at the other end
+// of the cable.
+type PTYPair struct {
+	// Master is the controlling end of the pseudo terminal.
+	Master SerialPort
+
+	// Slave is the end that poses as a serial port device.
+	Slave SerialPort
+
+	// SlavePath is the path of the slave device, e.g. "/dev/pts/3". Other
+	// programs can open it like a serial port.
+	SlavePath string
+}
+
+// Close closes both ends of the pair.
+func (pp *PTYPair) Close() error {
+	err := pp.Slave.Close()
+	if merr := pp.Master.Close(); err == nil {
+		err = merr
+	}
+	return err
+}
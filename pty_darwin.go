@@ -0,0 +1,39 @@
+// +build darwin
+
+package sers
+
+import (
+	"bytes"
+	"syscall"
+	"unsafe"
+)
+
+// openPTYMaster opens a new pseudo terminal master and unlocks the slave, as
+// posix_openpt(3), grantpt(3) and unlockpt(3) do.
+func openPTYMaster() (fd int, slavePath string, err error) {
+	fd, err = syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, "", &Error{"opening /dev/ptmx", err}
+	}
+	bp := &baseport{fd: fd}
+
+	if err := bp.ioctl(syscall.TIOCPTYGRANT, nil); err != nil {
+		syscall.Close(fd)
+		return -1, "", &Error{"ioctl: granting pty", err}
+	}
+	if err := bp.ioctl(syscall.TIOCPTYUNLK, nil); err != nil {
+		syscall.Close(fd)
+		return -1, "", &Error{"ioctl: unlocking pty", err}
+	}
+
+	var name [128]byte
+	if err := bp.ioctl(syscall.TIOCPTYGNAME, unsafe.Pointer(&name[0])); err != nil {
+		syscall.Close(fd)
+		return -1, "", &Error{"ioctl: getting pty name", err}
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return fd, string(name[:i]), nil
+	}
+
+	return fd, string(name[:]), nil
+}
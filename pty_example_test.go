@@ -0,0 +1,39 @@
+// +build darwin linux
+
+package sers_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/distributed/sers"
+)
+
+// This program opens a pseudo terminal pair and passes a message from one
+// end to the other, like a serial port connected to a device.
+func ExampleOpenPTYPair() {
+	pp, err := sers.OpenPTYPair()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pp.Close()
+
+	err = pp.Slave.SetReadParams(0, 1.0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = pp.Master.Write([]byte("ping"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var rb [16]byte
+	n, err := pp.Slave.Read(rb[:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s\n", rb[:n])
+	// Output: ping
+}
@@ -0,0 +1,33 @@
+// +build linux
+
+package sers
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// openPTYMaster opens a new pseudo terminal master and unlocks the slave, as
+// posix_openpt(3), grantpt(3) and unlockpt(3) do.
+func openPTYMaster() (fd int, slavePath string, err error) {
+	fd, err = syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, "", &Error{"opening /dev/ptmx", err}
+	}
+	bp := &baseport{fd: fd}
+
+	var unlock int32
+	if err := bp.ioctl(syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		syscall.Close(fd)
+		return -1, "", &Error{"ioctl: unlocking pty", err}
+	}
+
+	var n uint32
+	if err := bp.ioctl(syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		syscall.Close(fd)
+		return -1, "", &Error{"ioctl: getting pty number", err}
+	}
+
+	return fd, fmt.Sprintf("/dev/pts/%d", n), nil
+}
@@ -0,0 +1,16 @@
+// +build !darwin,!linux
+
+package sers
+
+import "net/url"
+
+// OpenPTYPair opens a new pseudo terminal and returns both of its ends. It is
+// only supported on termios platforms.
+func OpenPTYPair() (*PTYPair, error) {
+	return nil, StringError("pseudo terminals are not supported on this platform")
+}
+
+func openPTYURL(u *url.URL) (SerialPort, error) {
+	_, err := OpenPTYPair()
+	return nil, err
+}
@@ -0,0 +1,80 @@
+// +build darwin linux
+
+package sers
+
+import (
+	"net/url"
+	"syscall"
+)
+
+// OpenPTYPair opens a new pseudo terminal and returns both of its ends, in
+// raw mode. Pseudo terminals have no modem lines, so these are emulated as if
+// the ends were connected by a null modem cable, with DTR and RTS asserted on
+// both ends initially.
+//
+// The termios settings of a pseudo terminal are only partly honoured: the
+// baud rate has no effect and the slave always uses 8 data bits without
+// parity.
+func OpenPTYPair() (*PTYPair, error) {
+	fd, slavePath, err := openPTYMaster()
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := takeOverFD(fd, "/dev/ptmx")
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	slave, err := openTermios(slavePath, false)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	master.pty, slave.pty = true, true
+	connect(&master.softModem, &slave.softModem)
+	master.softModem.set(DTR|RTS, DTR|RTS)
+	slave.softModem.set(DTR|RTS, DTR|RTS)
+
+	return &PTYPair{Master: master, Slave: slave, SlavePath: slavePath}, nil
+}
+
+// ptyPort is the master of a pseudo terminal opened through a pty:// URL.
+// It keeps the slave open, so that the master is not hung up while no other
+// program has the slave open.
+type ptyPort struct {
+	*baseport
+	slave     SerialPort
+	slavePath string
+}
+
+// SlavePath returns the path of the slave device, which other programs can
+// open.
+func (pp *ptyPort) SlavePath() string {
+	return pp.slavePath
+}
+
+func (pp *ptyPort) Close() error {
+	err := pp.slave.Close()
+	if merr := pp.baseport.Close(); err == nil {
+		err = merr
+	}
+	return err
+}
+
+func openPTYURL(u *url.URL) (SerialPort, error) {
+	if err := checkURLParams(u); err != nil {
+		return nil, err
+	}
+	pair, err := OpenPTYPair()
+	if err != nil {
+		return nil, err
+	}
+	return &ptyPort{
+		baseport:  pair.Master.(*baseport),
+		slave:     pair.Slave,
+		slavePath: pair.SlavePath,
+	}, nil
+}
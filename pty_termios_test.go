@@ -0,0 +1,486 @@
+// +build darwin linux
+
+package sers
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func openPTYPair(t *testing.T) *PTYPair {
+	t.Helper()
+	pp, err := OpenPTYPair()
+	if err != nil {
+		t.Skipf("no pseudo terminals available: %v", err)
+	}
+	return pp
+}
+
+func TestPTYPairTransfer(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	if _, err := os.Stat(pp.SlavePath); err != nil {
+		t.Errorf("slave path %q: %v", pp.SlavePath, err)
+	}
+
+	for _, dir := range []struct {
+		name     string
+		from, to SerialPort
+	}{
+		{"master to slave", pp.Master, pp.Slave},
+		{"slave to master", pp.Slave, pp.Master},
+	} {
+		// raw mode, so neither line endings nor control characters are
+		// touched.
+		msg := []byte("hello\r\n\x03\x04\x11\x13\x7f world")
+		if _, err := dir.from.Write(msg); err != nil {
+			t.Fatalf("%s: %v", dir.name, err)
+		}
+
+		buf := make([]byte, len(msg))
+		if err := dir.to.SetReadParams(0, 2.0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(dir.to, buf); err != nil {
+			t.Fatalf("%s: %v", dir.name, err)
+		}
+		if string(buf) != string(msg) {
+			t.Errorf("%s: got %q, want %q", dir.name, buf, msg)
+		}
+	}
+}
+
+func TestPTYSetGetMode(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	// the slave insists on 8 data bits without parity
+	for _, mode := range []Mode{
+		{9600, 8, N, 1, NO_HANDSHAKE},
+		{115200, 8, N, 2, NO_HANDSHAKE},
+		{57600, 8, N, 1, RTSCTS_HANDSHAKE},
+		{4800, 8, N, 1, XONXOFF_HANDSHAKE},
+		{250000, 8, N, 1, NO_HANDSHAKE},
+	} {
+		err := pp.Slave.SetMode(mode.Baudrate, mode.DataBits, mode.Parity, mode.Stopbits, mode.Handshake)
+		if err != nil {
+			t.Errorf("SetMode(%v): %v", mode, err)
+			continue
+		}
+		got, err := pp.Slave.GetMode()
+		if err != nil {
+			t.Errorf("GetMode after SetMode(%v): %v", mode, err)
+			continue
+		}
+		if got != mode {
+			t.Errorf("GetMode after SetMode(%v) = %v", mode, got)
+		}
+	}
+
+	for _, mode := range []Mode{
+		{0, 8, N, 1, NO_HANDSHAKE},
+		{9600, 9, N, 1, NO_HANDSHAKE},
+		{9600, 8, 'X', 1, NO_HANDSHAKE},
+		{9600, 8, N, 3, NO_HANDSHAKE},
+		{9600, 8, N, 1, 17},
+	} {
+		err := pp.Slave.SetMode(mode.Baudrate, mode.DataBits, mode.Parity, mode.Stopbits, mode.Handshake)
+		if _, ok := err.(*ParameterError); !ok {
+			t.Errorf("SetMode(%v) returned %v, want *ParameterError", mode, err)
+		}
+	}
+}
+
+func TestSetModeRS485(t *testing.T) {
+	// a driver with RS-485 support, which setRS485Mode and SetRS485 act on
+	var rs rs485State
+	enabled := false
+	set := func(on bool) (bool, error) {
+		changed := enabled != on
+		enabled = on
+		return changed, nil
+	}
+	setMode := func(handshake int, exp bool) {
+		t.Helper()
+		if err := rs.setHandshake(handshake, set); err != nil {
+			t.Fatal(err)
+		}
+		if enabled != exp {
+			t.Errorf("RS-485 mode %v after setting handshake %d, want %v", enabled, handshake, exp)
+		}
+	}
+	setRS485 := func(on bool) {
+		t.Helper()
+		rs.configure(func() error {
+			enabled = on
+			return nil
+		})
+	}
+
+	setMode(NO_HANDSHAKE, false)
+	setMode(RS485_HANDSHAKE, true)
+	setMode(RS485_HANDSHAKE, true)
+	setMode(RTSCTS_HANDSHAKE, false)
+
+	// set up through SetRS485 and restored with the mode from GetMode,
+	// which reports RS485_HANDSHAKE
+	setRS485(true)
+	setMode(RS485_HANDSHAKE, true)
+	setMode(NO_HANDSHAKE, true)
+
+	// switched off through SetRS485 after RS485_HANDSHAKE had switched it
+	// on
+	setRS485(false)
+	setMode(RS485_HANDSHAKE, true)
+	setRS485(false)
+	setMode(RS485_HANDSHAKE, true)
+	setMode(NO_HANDSHAKE, false)
+
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	// pseudo terminals have no RS-485 mode, so switching it on fails, but
+	// only after the rest of the mode has been applied.
+	mode := Mode{19200, 8, N, 1, RS485_HANDSHAKE}
+	if err := pp.Slave.SetMode(mode.Baudrate, mode.DataBits, mode.Parity, mode.Stopbits, mode.Handshake); err == nil {
+		t.Fatalf("SetMode(%v) on a pseudo terminal succeeded", mode)
+	}
+	got, err := pp.Slave.GetMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Baudrate != mode.Baudrate {
+		t.Errorf("baud rate after failed SetMode(%v) is %d", mode, got.Baudrate)
+	}
+
+	// the failed attempt did not leave RS-485 mode marked as enabled, so no
+	// attempt is made to switch it off.
+	if err := pp.Slave.SetMode(9600, 8, N, 1, NO_HANDSHAKE); err != nil {
+		t.Errorf("SetMode after failed RS485_HANDSHAKE: %v", err)
+	}
+}
+
+func TestPTYReadTimeout(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	if err := pp.Slave.SetReadParams(0, 0.2); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 16)
+	start := time.Now()
+	n, err := pp.Slave.Read(buf)
+	d := time.Since(start)
+	if n != 0 || err == nil {
+		t.Fatalf("Read returned %d, %v, want timeout", n, err)
+	}
+	if _, ok := err.(termiosSersTimeout); !ok {
+		t.Errorf("Read returned error %v of type %T, want termiosSersTimeout", err, err)
+	}
+	if d < 150*time.Millisecond || d > 2*time.Second {
+		t.Errorf("Read timed out after %v, want about 200ms", d)
+	}
+
+	// data ends the read early
+	time.AfterFunc(50*time.Millisecond, func() { pp.Master.Write([]byte("ab")) })
+	n, err = pp.Slave.Read(buf)
+	if err != nil || string(buf[:n]) != "ab" {
+		t.Errorf("Read returned %q, %v, want %q", buf[:n], err, "ab")
+	}
+
+	// a deadline earlier than the timeout wins
+	if err := pp.Slave.SetReadParams(0, 2.0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.Slave.(interface{ SetReadDeadline(time.Time) error }).SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	_, err = pp.Slave.Read(buf)
+	if _, ok := err.(termiosSersTimeout); ok || !os.IsTimeout(err) {
+		t.Errorf("Read returned %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("deadline hit after %v, want about 100ms", d)
+	}
+
+	// minread blocks until enough data has arrived
+	pp.Slave.(interface{ SetReadDeadline(time.Time) error }).SetReadDeadline(time.Time{})
+	if err := pp.Slave.SetReadParams(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	// even if part of it is queued when the read starts
+	pp.Master.Write([]byte("cd"))
+	for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+		if n, _ := pp.Slave.(QueueStatus).InputWaiting(); n == 2 {
+			break
+		}
+	}
+	time.AfterFunc(100*time.Millisecond, func() { pp.Master.Write([]byte("e")) })
+	n, err = pp.Slave.Read(buf)
+	if err != nil || string(buf[:n]) != "cde" {
+		t.Errorf("Read returned %q, %v, want %q", buf[:n], err, "cde")
+	}
+}
+
+func TestPTYReadContext(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	buf := make([]byte, 16)
+	if _, err := ReadContext(ctx, pp.Slave, buf); err != context.DeadlineExceeded {
+		t.Errorf("ReadContext returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	pp.Master.Write([]byte("x"))
+	n, err := ReadContext(context.Background(), pp.Slave, buf)
+	if err != nil || string(buf[:n]) != "x" {
+		t.Errorf("ReadContext returned %q, %v, want %q", buf[:n], err, "x")
+	}
+}
+
+func TestPTYNullModem(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	master, slave := pp.Master.(ModemLines), pp.Slave.(ModemLines)
+
+	expect := func(ml ModemLines, exp ModemLine) {
+		t.Helper()
+		lines, err := ml.GetModemLines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines != exp {
+			t.Errorf("got modem lines %v, want %v", lines, exp)
+		}
+	}
+
+	all := DTR | RTS | CTS | DSR | DCD
+	expect(master, all)
+	expect(slave, all)
+
+	if err := master.SetDTR(false); err != nil {
+		t.Fatal(err)
+	}
+	expect(master, RTS|CTS|DSR|DCD)
+	expect(slave, DTR|RTS|CTS)
+
+	if err := slave.SetModemLines(DTR); err != nil {
+		t.Fatal(err)
+	}
+	expect(master, RTS|DSR|DCD)
+	expect(slave, DTR|CTS)
+
+	mw, ok := pp.Slave.(ModemWaiter)
+	if !ok {
+		return
+	}
+	time.AfterFunc(50*time.Millisecond, func() { master.SetRTS(false) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changed, err := mw.WaitModemChange(ctx, CTS)
+	if err != nil || changed != CTS {
+		t.Errorf("WaitModemChange returned %v, %v, want %v", changed, err, CTS)
+	}
+	expect(slave, DTR)
+}
+
+func TestPTYQueueStatus(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	qs := pp.Slave.(QueueStatus)
+	if _, err := pp.Master.Write([]byte("abcde")); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+		var err error
+		n, err = qs.InputWaiting()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 5 {
+			break
+		}
+	}
+	if n != 5 {
+		t.Errorf("InputWaiting returned %d, want 5", n)
+	}
+
+	if _, err := qs.OutputWaiting(); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitInput waits until qs has n bytes of input.
+func waitInput(t *testing.T, qs QueueStatus, n int) {
+	t.Helper()
+	var got int
+	for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+		var err error
+		got, err = qs.InputWaiting()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("InputWaiting returned %d, want %d", got, n)
+}
+
+func TestPTYFlush(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	master, slave := pp.Master.(QueueStatus), pp.Slave.(QueueStatus)
+	fl := pp.Slave.(Flusher)
+
+	// pending input is discarded
+	if _, err := pp.Master.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	waitInput(t, slave, 3)
+	if err := fl.FlushInput(); err != nil {
+		t.Fatal(err)
+	}
+	waitInput(t, slave, 0)
+	if _, err := pp.Master.Write([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.Slave.SetReadParams(0, 2.0); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	if n, err := pp.Slave.Read(buf); err != nil || string(buf[:n]) != "d" {
+		t.Errorf("Read after FlushInput returned %q, %v, want %q", buf[:n], err, "d")
+	}
+
+	// a pseudo terminal hands written data to the other end right away,
+	// so there is never any output left to discard.
+	if _, err := pp.Slave.Write([]byte("efg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fl.FlushOutput(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := slave.OutputWaiting(); err != nil || n != 0 {
+		t.Errorf("OutputWaiting after FlushOutput returned %d, %v, want 0", n, err)
+	}
+	waitInput(t, master, 3)
+}
+
+func TestPTYDrain(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	master, slave := pp.Master.(QueueStatus), pp.Slave.(QueueStatus)
+	fl := pp.Slave.(Flusher)
+
+	if _, err := pp.Slave.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fl.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := slave.OutputWaiting(); err != nil || n != 0 {
+		t.Errorf("OutputWaiting after Drain returned %d, %v, want 0", n, err)
+	}
+	waitInput(t, master, 5)
+	if err := pp.Master.(Flusher).FlushInput(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a cancelled context makes Drain flush the output and return the
+	// context's error.
+	if _, err := pp.Slave.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := fl.Drain(ctx); err != context.Canceled {
+		t.Errorf("Drain with a cancelled context returned %v, want %v", err, context.Canceled)
+	}
+	if n, err := slave.OutputWaiting(); err != nil || n != 0 {
+		t.Errorf("OutputWaiting after cancelled Drain returned %d, %v, want 0", n, err)
+	}
+}
+
+func TestOpenPTYURL(t *testing.T) {
+	sp, err := Open("pty://")
+	if err != nil {
+		t.Skipf("no pseudo terminals available: %v", err)
+	}
+	defer sp.Close()
+
+	path := sp.(interface{ SlavePath() string }).SlavePath()
+	slave, err := Open("file://" + path + "?mode=9600,8n1&timeout=2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	if _, err := sp.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(slave, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("slave read %q, %v, want %q", buf, err, "ping")
+	}
+
+	// the master keeps working after the other program has gone
+	slave.Close()
+	if _, err := sp.Write([]byte("pong")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenerURL(t *testing.T) {
+	pp := openPTYPair(t)
+	defer pp.Close()
+
+	dir, err := ioutil.TempDir("", "sers-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the options of the Opener apply to file URLs
+	o := Opener{LockFile: true, LockDir: dir}
+	sp, err := o.Open("file://" + pp.SlavePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files in lock directory after opening a file URL, want 1", len(entries))
+	}
+	_, err = o.Open("file://" + pp.SlavePath)
+	if _, ok := err.(*ErrPortBusy); !ok {
+		t.Errorf("opening a locked port through a file URL returned %v, want *ErrPortBusy", err)
+	}
+	sp.Close()
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files in lock directory after Close, want 0", len(entries))
+	}
+
+	// other schemes work as with Open
+	sp, err = o.Open("loop://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.Close()
+}
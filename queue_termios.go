@@ -0,0 +1,21 @@
+// +build darwin linux
+
+package sers
+
+var _ QueueStatus = (*baseport)(nil)
+
+func (bp *baseport) InputWaiting() (int, error) {
+	n, err := bp.queued(true)
+	if err != nil {
+		return 0, &Error{"querying input queue", err}
+	}
+	return n, nil
+}
+
+func (bp *baseport) OutputWaiting() (int, error) {
+	n, err := bp.queued(false)
+	if err != nil {
+		return 0, &Error{"querying output queue", err}
+	}
+	return n, nil
+}
@@ -0,0 +1,149 @@
+package sers
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// readBuffer holds data received in the background until it is read. Reads
+// follow the read parameters set through SetReadParams like they do on
+// termios platforms. It is used by ports that are not backed by a device.
+type readBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	avail   chan struct{} // closed and replaced when data arrives
+	err     error
+	minread int
+	timeout time.Duration
+}
+
+// newReadBuffer returns a readBuffer whose reads block until at least one
+// byte is available, as with a freshly opened port.
+func newReadBuffer() *readBuffer {
+	return &readBuffer{
+		minread: 1,
+		avail:   make(chan struct{}),
+	}
+}
+
+type bufferTimeout struct{}
+
+func (bufferTimeout) Error() string {
+	return "timeout"
+}
+
+func (bufferTimeout) Timeout() bool {
+	return true
+}
+
+// put adds p to the buffer. A non-nil err ends reading: once the buffer has
+// been read empty, reads return the first such error.
+func (rb *readBuffer) put(p []byte, err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.buf.Write(p)
+	if err != nil && rb.err == nil {
+		rb.err = err
+	}
+	if len(p) > 0 || err != nil {
+		close(rb.avail)
+		rb.avail = make(chan struct{})
+	}
+}
+
+// flush discards the buffered data.
+func (rb *readBuffer) flush() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.buf.Reset()
+}
+
+func (rb *readBuffer) setReadParams(minread int, timeout float64) error {
+	if minread < 0 {
+		return &ParameterError{"minread", "needs to be 0 or higher"}
+	}
+	if timeout < 0 {
+		return &ParameterError{"timeout", "needs to be 0 or higher"}
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.minread = minread
+	rb.timeout = time.Duration(timeout * float64(time.Second))
+	return nil
+}
+
+func (rb *readBuffer) read(b []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	want := rb.minread
+	if want > len(b) {
+		want = len(b)
+	}
+	if want < 1 {
+		want = 1
+	}
+
+	// as with VTIME, the timeout applies to the whole read without
+	// minread, and between bytes with minread.
+	var timer *time.Timer
+	var expire <-chan time.Time
+	resetTimer := func() {
+		if rb.timeout <= 0 {
+			return
+		}
+		if timer == nil {
+			timer = time.NewTimer(rb.timeout)
+			expire = timer.C
+			return
+		}
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(rb.timeout)
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	if rb.minread == 0 {
+		resetTimer()
+	}
+
+	for {
+		n := rb.buf.Len()
+		if n >= want || (n > 0 && rb.err != nil) {
+			return rb.buf.Read(b)
+		}
+		if rb.err != nil {
+			return 0, rb.err
+		}
+		if rb.minread == 0 && rb.timeout == 0 {
+			return 0, bufferTimeout{}
+		}
+
+		avail := rb.avail
+		rb.mu.Unlock()
+		expired := false
+		select {
+		case <-avail:
+		case <-expire:
+			expired = true
+		}
+		rb.mu.Lock()
+
+		if expired {
+			if rb.buf.Len() > 0 {
+				return rb.buf.Read(b)
+			}
+			return 0, bufferTimeout{}
+		}
+		if rb.minread > 0 && rb.buf.Len() > n {
+			resetTimer()
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package record
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+const header = "sers-recording 1"
+
+// Writer writes events in the file format described in the package
+// documentation. Every event is written with a single call to Write of the
+// underlying writer.
+type Writer struct {
+	w      io.Writer
+	header bool
+}
+
+// NewWriter returns a Writer writing to w. The header is written along with
+// the first event.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteEvent writes ev as a line of text.
+func (w *Writer) WriteEvent(ev *Event) error {
+	var sb strings.Builder
+	if !w.header {
+		sb.WriteString(header + "\n")
+	}
+
+	fmt.Fprintf(&sb, "%d.%09d %s", ev.Time/time.Second, ev.Time%time.Second, ev.Op)
+
+	switch ev.Op {
+	case Read, Write:
+		sb.WriteByte(' ')
+		if len(ev.Data) == 0 {
+			sb.WriteByte('-')
+		} else {
+			sb.WriteString(hex.EncodeToString(ev.Data))
+		}
+	case SetMode:
+		sb.WriteString(" " + ev.Mode.String())
+	case SetReadParams:
+		fmt.Fprintf(&sb, " %d %s", ev.MinRead, strconv.FormatFloat(ev.ReadTimeout, 'g', -1, 64))
+	case SetBreak:
+		if ev.Break {
+			sb.WriteString(" on")
+		} else {
+			sb.WriteString(" off")
+		}
+	case Close:
+	default:
+		return fmt.Errorf("record: cannot write event with invalid op %d", int(ev.Op))
+	}
+
+	if ev.TimedOut {
+		sb.WriteString(" timeout")
+	} else if ev.Err != "" {
+		sb.WriteString(" error " + strconv.Quote(ev.Err))
+	}
+	sb.WriteByte('\n')
+
+	if _, err := io.WriteString(w.w, sb.String()); err != nil {
+		return err
+	}
+	w.header = true
+	return nil
+}
+
+// Reader reads events in the file format described in the package
+// documentation.
+type Reader struct {
+	s      *bufio.Scanner
+	line   int
+	header bool
+}
+
+// maxLine limits the length of a line, i.e. a read or write of 8 MiB.
+const maxLine = 16 << 20
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLine)
+	return &Reader{s: s}
+}
+
+// Next returns the next event. At the end of the recording, it returns
+// io.EOF.
+func (r *Reader) Next() (*Event, error) {
+	for r.s.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.s.Text())
+		if !r.header {
+			if line != header {
+				return nil, r.errorf("not a recording or unsupported version, header is %q", line)
+			}
+			r.header = true
+			continue
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		return r.parse(line)
+	}
+
+	if err := r.s.Err(); err != nil {
+		return nil, err
+	}
+	if !r.header {
+		return nil, r.errorf("missing header")
+	}
+	return nil, io.EOF
+}
+
+func (r *Reader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("record: line %d: %s", r.line, fmt.Sprintf(format, args...))
+}
+
+func (r *Reader) parse(line string) (*Event, error) {
+	ev := &Event{}
+
+	// the error message may contain spaces, so it is split off first
+	if idx := strings.Index(line, " error "); idx >= 0 {
+		msg, err := strconv.Unquote(line[idx+len(" error "):])
+		if err != nil {
+			return nil, r.errorf("cannot parse error message: %v", err)
+		}
+		ev.Err = msg
+		line = line[:idx]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 && fields[len(fields)-1] == "timeout" {
+		ev.TimedOut = true
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) < 2 {
+		return nil, r.errorf("missing op")
+	}
+
+	t, err := parseTime(fields[0])
+	if err != nil {
+		return nil, r.errorf("%v", err)
+	}
+	ev.Time = t
+
+	args := fields[2:]
+	nargs := 1
+	switch fields[1] {
+	case "read", "write":
+		ev.Op = Read
+		if fields[1] == "write" {
+			ev.Op = Write
+		}
+		if len(args) == 1 && args[0] != "-" {
+			ev.Data, err = hex.DecodeString(args[0])
+		}
+	case "mode":
+		ev.Op = SetMode
+		if len(args) == 1 {
+			ev.Mode, err = sers.ParseModestring(args[0])
+		}
+	case "params":
+		ev.Op = SetReadParams
+		nargs = 2
+		if len(args) == 2 {
+			ev.MinRead, err = strconv.Atoi(args[0])
+			if err == nil {
+				ev.ReadTimeout, err = strconv.ParseFloat(args[1], 64)
+			}
+		}
+	case "break":
+		ev.Op = SetBreak
+		if len(args) == 1 {
+			switch args[0] {
+			case "on":
+				ev.Break = true
+			case "off":
+			default:
+				err = fmt.Errorf("break has to be on or off, not %q", args[0])
+			}
+		}
+	case "close":
+		ev.Op = Close
+		nargs = 0
+	default:
+		return nil, r.errorf("unknown op %q", fields[1])
+	}
+
+	if len(args) != nargs {
+		return nil, r.errorf("%s takes %d arguments, got %d", fields[1], nargs, len(args))
+	}
+	if err != nil {
+		return nil, r.errorf("%s: %v", fields[1], err)
+	}
+
+	return ev, nil
+}
+
+// parseTime parses a time in seconds with up to nine decimal places, exactly.
+func parseTime(s string) (time.Duration, error) {
+	secs, frac := s, ""
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		secs, frac = s[:idx], s[idx+1:]
+	}
+	if len(frac) > 9 {
+		return 0, fmt.Errorf("time %q has more than nine decimal places", s)
+	}
+
+	sec, err := strconv.ParseUint(secs, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse time %q", s)
+	}
+	var nsec uint64
+	if frac != "" {
+		nsec, err = strconv.ParseUint(frac+strings.Repeat("0", 9-len(frac)), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse time %q", s)
+		}
+	}
+
+	return time.Duration(sec)*time.Second + time.Duration(nsec), nil
+}
+
+// ReadAll reads all events of the recording in r.
+func ReadAll(r io.Reader) ([]Event, error) {
+	rd := NewReader(r)
+	var evs []Event
+	for {
+		ev, err := rd.Next()
+		if err == io.EOF {
+			return evs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, *ev)
+	}
+}
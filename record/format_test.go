@@ -0,0 +1,94 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+func TestWriterReader(t *testing.T) {
+	events := []Event{
+		{Time: 0, Op: SetMode, Mode: sers.Mode{Baudrate: 9600, DataBits: 8, Parity: sers.E, Stopbits: 1, Handshake: sers.NO_HANDSHAKE}},
+		{Time: 51200, Op: SetReadParams, MinRead: 0, ReadTimeout: 0.5},
+		{Time: 102400, Op: Write, Data: []byte("ATI\r")},
+		{Time: 21980160, Op: Read, Data: []byte("MODEM 1.0\r")},
+		{Time: 522113024, Op: Read, TimedOut: true},
+		{Time: 3*time.Second + 1, Op: SetBreak, Break: true},
+		{Time: 3*time.Second + 250*time.Millisecond, Op: SetBreak},
+		{Time: 4 * time.Second, Op: Write, Data: []byte{0, 0xff}, Err: "write /dev/ttyUSB0: input/output error"},
+		{Time: 5 * time.Second, Op: Close},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := range events {
+		if err := w.WriteEvent(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exp := `sers-recording 1
+0.000000000 mode 9600,8e1,none
+0.000051200 params 0 0.5
+0.000102400 write 4154490d
+0.021980160 read 4d4f44454d20312e300d
+0.522113024 read - timeout
+3.000000001 break on
+3.250000000 break off
+4.000000000 write 00ff error "write /dev/ttyUSB0: input/output error"
+5.000000000 close
+`
+	if buf.String() != exp {
+		t.Errorf("got recording\n%s\nwant\n%s", buf.String(), exp)
+	}
+
+	got, err := ReadAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("read back events\n%+v\nwant\n%+v", got, events)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	for _, rec := range []string{
+		"",
+		"sers-recording 2\n",
+		"0.1 read 41\n",
+		"sers-recording 1\n0.1\n",
+		"sers-recording 1\nx read 41\n",
+		"sers-recording 1\n0.1234567891 read 41\n",
+		"sers-recording 1\n0.1 read 4\n",
+		"sers-recording 1\n0.1 read\n",
+		"sers-recording 1\n0.1 read 41 42\n",
+		"sers-recording 1\n0.1 mode 9600,9x1\n",
+		"sers-recording 1\n0.1 params 1\n",
+		"sers-recording 1\n0.1 break maybe\n",
+		"sers-recording 1\n0.1 close now\n",
+		"sers-recording 1\n0.1 flush\n",
+		"sers-recording 1\n0.1 write 41 error unquoted\n",
+	} {
+		if _, err := ReadAll(strings.NewReader(rec)); err == nil {
+			t.Errorf("reading %q succeeded, expected error", rec)
+		}
+	}
+
+	// comments and empty lines are fine, and so are shorter fractions
+	rd := NewReader(strings.NewReader("sers-recording 1\n# comment\n\n1.5 read 41\n"))
+	ev, err := rd.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Time != 1500*time.Millisecond || string(ev.Data) != "A" {
+		t.Errorf("got event %+v", ev)
+	}
+	if _, err := rd.Next(); err != io.EOF {
+		t.Errorf("got %v at the end, want io.EOF", err)
+	}
+}
@@ -0,0 +1,360 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+// LinkTypeUser0 is the first of the link types reserved for private use,
+// DLT_USER0. Wireshark can be told which dissector to use for it, e.g.
+// Modbus RTU.
+const LinkTypeUser0 = 147
+
+// pcapng block types
+const (
+	blockSHB = 0x0a0d0d0a // section header
+	blockIDB = 0x00000001 // interface description
+	blockEPB = 0x00000006 // enhanced packet
+)
+
+// pcapng option codes, by block type
+const (
+	optEndOfOpt = 0
+	optComment  = 1
+
+	optUserAppl = 4 // shb_userappl
+
+	optIfName    = 2 // if_name
+	optIfDescr   = 3 // if_description
+	optIfSpeed   = 8 // if_speed
+	optIfTSResol = 9 // if_tsresol
+
+	optEPBFlags = 2 // epb_flags
+)
+
+// directions in epb_flags
+const (
+	epbInbound  = 1
+	epbOutbound = 2
+)
+
+const byteOrderMagic = 0x1a2b3c4d
+
+// maxPacket limits the size of a packet. Longer bursts are split.
+const maxPacket = 65535
+
+// PcapngWriter is an EventWriter that saves the traffic of a port in the
+// pcapng format, for analysis with Wireshark and similar tools.
+//
+// Consecutive reads or writes are merged into a packet until the direction
+// changes or the line has been idle for IdleGap. Packets carry their
+// direction, inbound for data read and outbound for data written. Every
+// mode set through SetMode starts a new interface, whose description and
+// speed reflect the mode. Mode changes and breaks are noted in the comment of
+// the following packet.
+//
+// The fields have to be set before the first event is written. Packets are
+// held back until they are complete, Flush writes a pending packet.
+type PcapngWriter struct {
+	// LinkType is the link type of the interfaces, LinkTypeUser0 if zero.
+	LinkType uint16
+
+	// Name is the name of the interfaces, e.g. the path of the port.
+	Name string
+
+	// IdleGap is the idle time after which a new packet is started. If
+	// zero, it is the time needed to transmit 3.5 characters in the
+	// current mode, as with Modbus RTU, or 5ms as long as the mode is
+	// unknown.
+	IdleGap time.Duration
+
+	// Start is the wall clock time of the start of the recording, to which
+	// the times of the events are added. NewPcapngWriter sets it to the
+	// current time.
+	Start time.Time
+
+	w       io.Writer
+	started bool
+	iface   int // index of the current interface, -1 if none
+	mode    sers.Mode
+
+	// pending is the packet being assembled, comments are those for the
+	// next packet, the first of which was made at commentTime.
+	pending     *packet
+	comments    []string
+	commentTime time.Duration
+}
+
+type packet struct {
+	inbound    bool
+	start, end time.Duration
+	data       []byte
+	comments   []string
+}
+
+// NewPcapngWriter returns a PcapngWriter writing to w, naming the
+// interfaces name.
+func NewPcapngWriter(w io.Writer, name string) *PcapngWriter {
+	return &PcapngWriter{
+		Name:  name,
+		Start: time.Now(),
+		w:     w,
+		iface: -1,
+	}
+}
+
+// WriteEvent adds ev to the capture.
+func (pw *PcapngWriter) WriteEvent(ev *Event) error {
+	if !pw.started {
+		if err := pw.writeSHB(); err != nil {
+			return err
+		}
+		pw.started = true
+	}
+
+	switch ev.Op {
+	case Read, Write:
+		if len(ev.Data) == 0 {
+			return nil
+		}
+		return pw.addData(ev.Op == Read, ev.Time, ev.Data)
+	case SetMode:
+		if err := pw.Flush(); err != nil {
+			return err
+		}
+		if ev.Err != "" {
+			pw.comment(ev.Time, "mode "+ev.Mode.String()+" failed: "+ev.Err)
+			return nil
+		}
+		pw.mode = ev.Mode
+		pw.comment(ev.Time, "mode "+ev.Mode.String())
+		return pw.writeIDB()
+	case SetBreak:
+		if err := pw.Flush(); err != nil {
+			return err
+		}
+		if ev.Break {
+			pw.comment(ev.Time, "break on")
+		} else {
+			pw.comment(ev.Time, "break off")
+		}
+	case Close:
+		if err := pw.Flush(); err != nil {
+			return err
+		}
+		// comments not followed by data get an empty packet of their own
+		if len(pw.comments) > 0 {
+			p := &packet{start: pw.commentTime, end: pw.commentTime, comments: pw.comments}
+			pw.comments = nil
+			return pw.writeEPB(p, false)
+		}
+	}
+
+	return nil
+}
+
+// comment adds a comment to the next packet.
+func (pw *PcapngWriter) comment(t time.Duration, c string) {
+	if len(pw.comments) == 0 {
+		pw.commentTime = t
+	}
+	pw.comments = append(pw.comments, c)
+}
+
+// charTime returns the time needed to transmit one character in the current
+// mode, 0 if the mode is unknown.
+func (pw *PcapngWriter) charTime() time.Duration {
+	m := pw.mode
+	if m.Baudrate <= 0 || !m.Valid() {
+		return 0
+	}
+	bits := 1 + m.DataBits + m.Stopbits
+	if m.Parity != sers.N {
+		bits++
+	}
+	return time.Duration(bits) * time.Second / time.Duration(m.Baudrate)
+}
+
+func (pw *PcapngWriter) idleGap() time.Duration {
+	if pw.IdleGap > 0 {
+		return pw.IdleGap
+	}
+	if ct := pw.charTime(); ct > 0 {
+		return ct * 7 / 2
+	}
+	return 5 * time.Millisecond
+}
+
+func (pw *PcapngWriter) addData(inbound bool, t time.Duration, data []byte) error {
+	// reads are recorded when they return, after the data has arrived,
+	// writes when they are made, before the data is transmitted.
+	duration := time.Duration(len(data)) * pw.charTime()
+	start, end := t, t+duration
+	if inbound {
+		start, end = t-duration, t
+	}
+
+	if p := pw.pending; p != nil {
+		if p.inbound != inbound || start-p.end > pw.idleGap() || len(p.data)+len(data) > maxPacket {
+			if err := pw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if pw.pending == nil {
+		if start < 0 {
+			start = 0
+		}
+		pw.pending = &packet{inbound: inbound, start: start, comments: pw.comments}
+		pw.comments = nil
+	}
+
+	p := pw.pending
+	for len(data) > 0 {
+		n := maxPacket - len(p.data)
+		if n > len(data) {
+			n = len(data)
+		}
+		p.data = append(p.data, data[:n]...)
+		data = data[n:]
+		if len(data) > 0 {
+			if err := pw.Flush(); err != nil {
+				return err
+			}
+			p = &packet{inbound: inbound, start: start}
+			pw.pending = p
+		}
+	}
+	if end > p.end {
+		p.end = end
+	}
+
+	return nil
+}
+
+// Flush writes the packet being assembled, if any.
+func (pw *PcapngWriter) Flush() error {
+	p := pw.pending
+	if p == nil {
+		return nil
+	}
+	pw.pending = nil
+	return pw.writeEPB(p, true)
+}
+
+// block assembles a pcapng block from its body and options.
+type block struct {
+	typ  uint32
+	body bytes.Buffer
+}
+
+func (b *block) put(v interface{}) {
+	binary.Write(&b.body, binary.LittleEndian, v)
+}
+
+func (b *block) option(code uint16, value []byte) {
+	b.put(code)
+	b.put(uint16(len(value)))
+	b.body.Write(value)
+	b.pad()
+}
+
+func (b *block) pad() {
+	for b.body.Len()%4 != 0 {
+		b.body.WriteByte(0)
+	}
+}
+
+func (pw *PcapngWriter) writeBlock(b *block) error {
+	length := uint32(b.body.Len() + 12)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, b.typ)
+	binary.Write(&buf, binary.LittleEndian, length)
+	buf.Write(b.body.Bytes())
+	binary.Write(&buf, binary.LittleEndian, length)
+
+	_, err := pw.w.Write(buf.Bytes())
+	return err
+}
+
+func (pw *PcapngWriter) writeSHB() error {
+	b := &block{typ: blockSHB}
+	b.put(uint32(byteOrderMagic))
+	b.put(uint16(1)) // major version
+	b.put(uint16(0)) // minor version
+	b.put(int64(-1)) // section length not specified
+	b.option(optUserAppl, []byte("sers"))
+	b.option(optEndOfOpt, nil)
+	return pw.writeBlock(b)
+}
+
+func (pw *PcapngWriter) writeIDB() error {
+	linkType := pw.LinkType
+	if linkType == 0 {
+		linkType = LinkTypeUser0
+	}
+
+	b := &block{typ: blockIDB}
+	b.put(linkType)
+	b.put(uint16(0)) // reserved
+	b.put(uint32(0)) // no snap length
+	if pw.Name != "" {
+		b.option(optIfName, []byte(pw.Name))
+	}
+	if pw.mode.Valid() {
+		b.option(optIfDescr, []byte(pw.mode.String()))
+		speed := make([]byte, 8)
+		binary.LittleEndian.PutUint64(speed, uint64(pw.mode.Baudrate))
+		b.option(optIfSpeed, speed)
+	}
+	b.option(optIfTSResol, []byte{9}) // nanoseconds
+	b.option(optEndOfOpt, nil)
+
+	if err := pw.writeBlock(b); err != nil {
+		return err
+	}
+	pw.iface++
+	return nil
+}
+
+func (pw *PcapngWriter) writeEPB(p *packet, withDirection bool) error {
+	if pw.iface < 0 {
+		// data before the first SetMode
+		if err := pw.writeIDB(); err != nil {
+			return err
+		}
+	}
+
+	ts := uint64(pw.Start.Add(p.start).UnixNano())
+
+	b := &block{typ: blockEPB}
+	b.put(uint32(pw.iface))
+	b.put(uint32(ts >> 32))
+	b.put(uint32(ts))
+	b.put(uint32(len(p.data))) // captured length
+	b.put(uint32(len(p.data))) // original length
+	b.body.Write(p.data)
+	b.pad()
+
+	if withDirection {
+		flags := make([]byte, 4)
+		if p.inbound {
+			binary.LittleEndian.PutUint32(flags, epbInbound)
+		} else {
+			binary.LittleEndian.PutUint32(flags, epbOutbound)
+		}
+		b.option(optEPBFlags, flags)
+	}
+	for _, c := range p.comments {
+		b.option(optComment, []byte(c))
+	}
+	b.option(optEndOfOpt, nil)
+
+	return pw.writeBlock(b)
+}
@@ -0,0 +1,193 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+type pcapngBlock struct {
+	typ     uint32
+	body    []byte
+	options map[uint16][][]byte
+}
+
+// readPcapng splits a little endian pcapng file into its blocks and parses
+// the options of section headers, interface descriptions and enhanced
+// packets.
+func readPcapng(t *testing.T, b []byte) []pcapngBlock {
+	t.Helper()
+	var blocks []pcapngBlock
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated block header")
+		}
+		typ := binary.LittleEndian.Uint32(b)
+		length := int(binary.LittleEndian.Uint32(b[4:]))
+		if length%4 != 0 || length < 12 || length > len(b) {
+			t.Fatalf("block of type %#x has bad length %d", typ, length)
+		}
+		if trailer := int(binary.LittleEndian.Uint32(b[length-4:])); trailer != length {
+			t.Fatalf("block of type %#x has trailing length %d, want %d", typ, trailer, length)
+		}
+		blk := pcapngBlock{typ: typ, body: b[8 : length-4]}
+
+		var opts []byte
+		switch typ {
+		case blockSHB:
+			opts = blk.body[16:]
+		case blockIDB:
+			opts = blk.body[8:]
+		case blockEPB:
+			n := int(binary.LittleEndian.Uint32(blk.body[12:]))
+			opts = blk.body[20+(n+3)/4*4:]
+		}
+		blk.options = make(map[uint16][][]byte)
+		for len(opts) >= 4 {
+			code := binary.LittleEndian.Uint16(opts)
+			n := int(binary.LittleEndian.Uint16(opts[2:]))
+			if code == optEndOfOpt {
+				break
+			}
+			blk.options[code] = append(blk.options[code], opts[4:4+n])
+			opts = opts[4+(n+3)/4*4:]
+		}
+
+		blocks = append(blocks, blk)
+		b = b[length:]
+	}
+	return blocks
+}
+
+func TestPcapngWriter(t *testing.T) {
+	mode := sers.Mode{Baudrate: 9600, DataBits: 8, Parity: sers.E, Stopbits: 1, Handshake: sers.NO_HANDSHAKE}
+	ms := time.Millisecond
+	events := []Event{
+		{Time: 0, Op: SetMode, Mode: mode},
+		{Time: 1 * ms, Op: SetReadParams, ReadTimeout: 0.5},
+		{Time: 2 * ms, Op: Write, Data: []byte{0x01, 0x03}},
+		{Time: 3 * ms, Op: Write, Data: []byte{0x00, 0x00, 0x00, 0x02}},
+		// a character takes 1.146ms at 9600,8e1: these reads arrive back to
+		// back, the third one after a pause.
+		{Time: 20 * ms, Op: Read, Data: []byte{0x01, 0x03}},
+		{Time: 25 * ms, Op: Read, Data: []byte{0x04, 0x00, 0x2a}},
+		{Time: 40 * ms, Op: Read, Data: []byte{0xff}},
+		{Time: 540 * ms, Op: Read, TimedOut: true},
+		{Time: 600 * ms, Op: SetBreak, Break: true},
+		{Time: 700 * ms, Op: SetBreak},
+		{Time: 701 * ms, Op: Write, Data: []byte("x")},
+		{Time: 800 * ms, Op: SetMode, Mode: sers.Mode{Baudrate: 19200, DataBits: 8, Parity: sers.N, Stopbits: 1, Handshake: sers.NO_HANDSHAKE}},
+		{Time: 900 * ms, Op: Close},
+	}
+
+	var buf bytes.Buffer
+	pw := NewPcapngWriter(&buf, "/dev/ttyUSB0")
+	pw.Start = time.Unix(1500000000, 0)
+	for i := range events {
+		if err := pw.WriteEvent(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks := readPcapng(t, buf.Bytes())
+
+	type pkt struct {
+		iface    uint32
+		ts       time.Duration
+		data     string
+		dir      uint32
+		comments []string
+	}
+	var types []uint32
+	var idbs []pcapngBlock
+	var pkts []pkt
+	for _, blk := range blocks {
+		types = append(types, blk.typ)
+		switch blk.typ {
+		case blockIDB:
+			idbs = append(idbs, blk)
+		case blockEPB:
+			ts := uint64(binary.LittleEndian.Uint32(blk.body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(blk.body[8:]))
+			n := binary.LittleEndian.Uint32(blk.body[12:])
+			p := pkt{
+				iface: binary.LittleEndian.Uint32(blk.body),
+				ts:    time.Duration(int64(ts) - pw.Start.UnixNano()),
+				data:  string(blk.body[20 : 20+n]),
+			}
+			if f := blk.options[optEPBFlags]; len(f) == 1 {
+				p.dir = binary.LittleEndian.Uint32(f[0])
+			}
+			for _, c := range blk.options[optComment] {
+				p.comments = append(p.comments, string(c))
+			}
+			pkts = append(pkts, p)
+		}
+	}
+
+	expTypes := []uint32{blockSHB, blockIDB, blockEPB, blockEPB, blockEPB, blockEPB, blockIDB, blockEPB}
+	if !reflect.DeepEqual(types, expTypes) {
+		t.Fatalf("got blocks %x, want %x", types, expTypes)
+	}
+
+	if len(idbs) != 2 {
+		t.Fatalf("got %d interfaces, want 2", len(idbs))
+	}
+	for i, exp := range []struct {
+		descr string
+		speed uint64
+	}{{"9600,8e1,none", 9600}, {"19200,8n1,none", 19200}} {
+		idb := idbs[i]
+		if lt := binary.LittleEndian.Uint16(idb.body); lt != LinkTypeUser0 {
+			t.Errorf("interface %d: got link type %d, want %d", i, lt, LinkTypeUser0)
+		}
+		if name := idb.options[optIfName]; len(name) != 1 || string(name[0]) != "/dev/ttyUSB0" {
+			t.Errorf("interface %d: got name %q", i, name)
+		}
+		if d := idb.options[optIfDescr]; len(d) != 1 || string(d[0]) != exp.descr {
+			t.Errorf("interface %d: got description %q, want %q", i, d, exp.descr)
+		}
+		if s := idb.options[optIfSpeed]; len(s) != 1 || binary.LittleEndian.Uint64(s[0]) != exp.speed {
+			t.Errorf("interface %d: got speed %v, want %d", i, s, exp.speed)
+		}
+	}
+
+	charTime := 11 * time.Second / 9600
+	expPkts := []pkt{
+		{0, 2 * ms, "\x01\x03\x00\x00\x00\x02", epbOutbound, []string{"mode 9600,8e1,none"}},
+		{0, 20*ms - 2*charTime, "\x01\x03\x04\x00\x2a", epbInbound, nil},
+		{0, 40*ms - charTime, "\xff", epbInbound, nil},
+		{0, 701 * ms, "x", epbOutbound, []string{"break on", "break off"}},
+		{1, 800 * ms, "", 0, []string{"mode 19200,8n1,none"}},
+	}
+	if !reflect.DeepEqual(pkts, expPkts) {
+		t.Errorf("got packets\n%+v\nwant\n%+v", pkts, expPkts)
+	}
+}
+
+func TestPcapngWriterSplitsLongPackets(t *testing.T) {
+	var buf bytes.Buffer
+	pw := NewPcapngWriter(&buf, "")
+	data := make([]byte, maxPacket+10)
+	for _, ev := range []Event{
+		{Time: 0, Op: Read, Data: data},
+		{Time: time.Millisecond, Op: Close},
+	} {
+		if err := pw.WriteEvent(&ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sizes []int
+	for _, blk := range readPcapng(t, buf.Bytes()) {
+		if blk.typ == blockEPB {
+			sizes = append(sizes, int(binary.LittleEndian.Uint32(blk.body[12:])))
+		}
+	}
+	if exp := []int{maxPacket, 10}; !reflect.DeepEqual(sizes, exp) {
+		t.Errorf("got packets of %v bytes, want %v", sizes, exp)
+	}
+}
@@ -0,0 +1,122 @@
+// Package record records what happens on a serial port: the data read and
+// written as well as changes of the configuration, each with a timestamp.
+//
+// A Recorder wraps a sers.SerialPort and hands the events to an
+// EventWriter, such as the Writer for the file format described below.
+// Recordings can be read back with a Reader and played back with the
+// Replayer of package serialtest. A PcapngWriter saves the traffic for
+// analysis with Wireshark instead.
+//
+// Recordings are stored as line based text. The first line is
+// "sers-recording 1", naming the version of the format. Empty lines and lines
+// starting with '#' are ignored. Every other line describes one event:
+//
+//	<time> <op> [<arguments>] [<status>]
+//
+// time is the time since the start of the recording, in seconds with nine
+// decimal places. It is taken from the monotonic clock, so it is not
+// affected by changes of the wall clock. For reads, it is the time the read
+// returned, for all other events the time the call was made.
+//
+// The ops and their arguments are:
+//
+//	read <data>              data read, hexadecimal, "-" if none
+//	write <data>             data written, hexadecimal, "-" if none
+//	mode <mode>              SetMode, mode as a modestring, e.g. 9600,8e1,none
+//	params <minread> <secs>  SetReadParams
+//	break on|off             SetBreak
+//	close                    Close
+//
+// status is "timeout" if the call returned a timeout error, or "error"
+// followed by the error message as a Go quoted string for other errors. It
+// is missing if the call succeeded. Example:
+//
+//	sers-recording 1
+//	0.000000000 mode 9600,8e1,none
+//	0.000051200 params 0 0.5
+//	0.000102400 write 4154490d
+//	0.021980160 read 4d4f44454d20312e300d
+//	0.522113024 read - timeout
+//	0.530000000 close
+package record
+
+import (
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+// Op is the kind of an Event.
+type Op int
+
+const (
+	Read Op = iota + 1
+	Write
+	SetMode
+	SetReadParams
+	SetBreak
+	Close
+)
+
+var opNames = map[Op]string{
+	Read:          "read",
+	Write:         "write",
+	SetMode:       "mode",
+	SetReadParams: "params",
+	SetBreak:      "break",
+	Close:         "close",
+}
+
+// String returns the name of the op as used in the file format.
+func (op Op) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// Event is a single call on a recorded port.
+type Event struct {
+	// Time is the time since the start of the recording.
+	Time time.Duration
+
+	Op Op
+
+	// Data is the data read or written, for Read and Write.
+	Data []byte
+
+	// Mode is set for SetMode.
+	Mode sers.Mode
+
+	// MinRead and ReadTimeout are the arguments of SetReadParams.
+	MinRead     int
+	ReadTimeout float64
+
+	// Break is set for SetBreak.
+	Break bool
+
+	// TimedOut reports whether the call returned a timeout error. For
+	// other errors, Err holds the error message.
+	TimedOut bool
+	Err      string
+}
+
+// setErr records the outcome of a call in ev.
+func (ev *Event) setErr(err error) {
+	if err == nil {
+		return
+	}
+	if te, ok := err.(interface{ Timeout() bool }); ok && te.Timeout() {
+		ev.TimedOut = true
+		return
+	}
+	ev.Err = err.Error()
+	if ev.Err == "" {
+		ev.Err = "error"
+	}
+}
+
+// EventWriter receives the events of a Recorder.
+type EventWriter interface {
+	WriteEvent(ev *Event) error
+}
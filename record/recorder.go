@@ -0,0 +1,119 @@
+package record
+
+import (
+	"sync"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+// Recorder is a sers.SerialPort that passes all calls on to another port and
+// records them. Failures to write events do not affect the calls, they are
+// reported by Err.
+type Recorder struct {
+	sp    sers.SerialPort
+	ew    EventWriter
+	start time.Time
+
+	lock sync.Mutex
+	err  error
+}
+
+var _ sers.SerialPort = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder for sp, writing events to ew. The recording
+// starts right away.
+func NewRecorder(sp sers.SerialPort, ew EventWriter) *Recorder {
+	return &Recorder{sp: sp, ew: ew, start: time.Now()}
+}
+
+// Port returns the recorded port.
+func (r *Recorder) Port() sers.SerialPort {
+	return r.sp
+}
+
+// Err returns the first error encountered while writing events. After an
+// error, no more events are written.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// since returns the time since the start of the recording. time.Time
+// carries a monotonic clock reading, so this is not affected by changes of
+// the wall clock.
+func (r *Recorder) since() time.Duration {
+	return time.Since(r.start)
+}
+
+func (r *Recorder) record(ev *Event, err error) {
+	ev.setErr(err)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.ew.WriteEvent(ev)
+}
+
+func (r *Recorder) Read(b []byte) (int, error) {
+	n, err := r.sp.Read(b)
+	data := make([]byte, n)
+	copy(data, b)
+	r.record(&Event{Time: r.since(), Op: Read, Data: data}, err)
+	return n, err
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	t := r.since()
+	n, err := r.sp.Write(b)
+	data := make([]byte, n)
+	copy(data, b)
+	r.record(&Event{Time: t, Op: Write, Data: data}, err)
+	return n, err
+}
+
+func (r *Recorder) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
+	ev := &Event{
+		Time: r.since(),
+		Op:   SetMode,
+		Mode: sers.Mode{
+			Baudrate:  baudrate,
+			DataBits:  databits,
+			Parity:    parity,
+			Stopbits:  stopbits,
+			Handshake: handshake,
+		},
+	}
+	err := r.sp.SetMode(baudrate, databits, parity, stopbits, handshake)
+	r.record(ev, err)
+	return err
+}
+
+func (r *Recorder) GetMode() (sers.Mode, error) {
+	return r.sp.GetMode()
+}
+
+func (r *Recorder) SetReadParams(minread int, timeout float64) error {
+	ev := &Event{Time: r.since(), Op: SetReadParams, MinRead: minread, ReadTimeout: timeout}
+	err := r.sp.SetReadParams(minread, timeout)
+	r.record(ev, err)
+	return err
+}
+
+func (r *Recorder) SetBreak(on bool) error {
+	ev := &Event{Time: r.since(), Op: SetBreak, Break: on}
+	err := r.sp.SetBreak(on)
+	r.record(ev, err)
+	return err
+}
+
+// Close closes the recorded port. The EventWriter is left open.
+func (r *Recorder) Close() error {
+	ev := &Event{Time: r.since(), Op: Close}
+	err := r.sp.Close()
+	r.record(ev, err)
+	return err
+}
@@ -0,0 +1,441 @@
+package sers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/distributed/sers/internal/telnet"
+)
+
+// rfc2217ResponseTimeout limits the time to wait for the server to accept
+// the connection and to answer a request.
+const rfc2217ResponseTimeout = 5 * time.Second
+
+// OpenRFC2217 connects to the RFC 2217 server at addr, given as host:port,
+// and returns the remote serial port. SetMode, GetMode and SetBreak are
+// carried out by the server, as are the methods of ModemLines, which the
+// port implements. The status lines reflect the last notification from
+// the server.
+//
+// The read parameters set through SetReadParams are applied locally to the
+// data received from the server. As with Open, reads initially block until
+// at least one byte is available.
+//
+// Connecting fails if the server does not accept the connection within 5
+// seconds.
+func OpenRFC2217(addr string) (SerialPort, error) {
+	conn, err := net.DialTimeout("tcp", addr, rfc2217ResponseTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &rfc2217Port{
+		conn:   conn,
+		rb:     newReadBuffer(),
+		resp:   make(chan telnet.Command, 16),
+		ready:  make(chan bool, 1),
+		closed: make(chan struct{}),
+		opts: telnet.Options{
+			Local:  []byte{telnet.Binary, telnet.SuppressGA, telnet.ComPortOption},
+			Remote: []byte{telnet.Binary, telnet.SuppressGA, telnet.ComPortOption},
+		},
+	}
+	// the options are owned by the receiving goroutine once it runs
+	if err := rp.write(rp.opts.Request(nil)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go rp.receive()
+
+	select {
+	case ok := <-rp.ready:
+		if !ok {
+			rp.Close()
+			return nil, &Error{"rfc2217 negotiation", StringError("server refused the com port option")}
+		}
+	case <-time.After(rfc2217ResponseTimeout):
+		rp.Close()
+		return nil, &Error{"rfc2217 negotiation", StringError("timeout waiting for server")}
+	}
+
+	// ask for the state of the status lines, notifications keep it current
+	if err := rp.write(telnet.Subnegotiation(telnet.ComPortOption, telnet.NotifyModemstate)); err != nil {
+		rp.Close()
+		return nil, err
+	}
+
+	return rp, nil
+}
+
+type rfc2217Port struct {
+	conn net.Conn
+	wmu  sync.Mutex // serializes writes to conn
+
+	// reqmu serializes requests, one response is awaited at a time.
+	reqmu sync.Mutex
+	resp  chan telnet.Command
+
+	opts   telnet.Options
+	ready  chan bool
+	closed chan struct{}
+	once   sync.Once
+
+	rb *readBuffer
+
+	mu    sync.Mutex
+	modem byte
+}
+
+var _ ModemLines = (*rfc2217Port)(nil)
+
+func (rp *rfc2217Port) write(p []byte) error {
+	rp.wmu.Lock()
+	defer rp.wmu.Unlock()
+	_, err := rp.conn.Write(p)
+	return err
+}
+
+// receive separates data and commands sent by the server until the
+// connection fails.
+func (rp *rfc2217Port) receive() {
+	var dec telnet.Decoder
+	p := make([]byte, 1024)
+	for {
+		n, err := rp.conn.Read(p)
+		var reply []byte
+		n = dec.Decode(p[:n], func(data []byte, cmd telnet.Command) {
+			rp.rb.put(data, nil)
+			reply = rp.handle(reply, cmd)
+		})
+		if len(reply) > 0 {
+			rp.write(reply)
+		}
+
+		if err != nil {
+			select {
+			case <-rp.closed:
+				err = errPortClosed
+			default:
+				err = &Error{"rfc2217 connection", err}
+			}
+		}
+		rp.rb.put(p[:n], err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (rp *rfc2217Port) handle(reply []byte, cmd telnet.Command) []byte {
+	switch cmd.Verb {
+	case telnet.WILL, telnet.WONT, telnet.DO, telnet.DONT:
+		reply = rp.opts.Handle(reply, cmd.Verb, cmd.Option)
+		if cmd.Option == telnet.ComPortOption && (cmd.Verb == telnet.DO || cmd.Verb == telnet.DONT) {
+			select {
+			case rp.ready <- rp.opts.LocalEnabled(telnet.ComPortOption):
+			default:
+			}
+		}
+	case telnet.SB:
+		if cmd.Option != telnet.ComPortOption || len(cmd.Params) == 0 {
+			break
+		}
+		switch cmd.Params[0] {
+		case telnet.NotifyModemstate + telnet.ServerOffset:
+			if len(cmd.Params) > 1 {
+				rp.mu.Lock()
+				rp.modem = cmd.Params[1]
+				rp.mu.Unlock()
+			}
+		case telnet.NotifyLinestate + telnet.ServerOffset:
+		default:
+			select {
+			case rp.resp <- cmd:
+			default:
+			}
+		}
+	}
+	return reply
+}
+
+// request sends a com port subcommand and returns the parameters of the
+// server's response.
+func (rp *rfc2217Port) request(subcmd byte, params ...byte) ([]byte, error) {
+	rp.reqmu.Lock()
+	defer rp.reqmu.Unlock()
+
+	// drop responses that arrived after their request timed out
+	for len(rp.resp) > 0 {
+		<-rp.resp
+	}
+
+	msg := telnet.Subnegotiation(telnet.ComPortOption, append([]byte{subcmd}, params...)...)
+	if err := rp.write(msg); err != nil {
+		return nil, &Error{"rfc2217 request", err}
+	}
+
+	timeout := time.NewTimer(rfc2217ResponseTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case cmd := <-rp.resp:
+			if cmd.Params[0] == subcmd+telnet.ServerOffset {
+				return cmd.Params[1:], nil
+			}
+		case <-rp.closed:
+			return nil, errPortClosed
+		case <-timeout.C:
+			return nil, &Error{"rfc2217 request", bufferTimeout{}}
+		}
+	}
+}
+
+// requestValue sends a subcommand with a single byte parameter and returns
+// the value of the response.
+func (rp *rfc2217Port) requestValue(subcmd, value byte) (byte, error) {
+	resp, err := rp.request(subcmd, value)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 1 {
+		return 0, &Error{"rfc2217 request", fmt.Errorf("malformed response %v", resp)}
+	}
+	return resp[0], nil
+}
+
+func (rp *rfc2217Port) Read(b []byte) (int, error) {
+	return rp.rb.read(b)
+}
+
+func (rp *rfc2217Port) Write(b []byte) (int, error) {
+	select {
+	case <-rp.closed:
+		return 0, errPortClosed
+	default:
+	}
+	if err := rp.write(telnet.Escape(nil, b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (rp *rfc2217Port) Close() error {
+	rp.once.Do(func() {
+		close(rp.closed)
+		rp.conn.Close()
+	})
+	return nil
+}
+
+var rfc2217Parities = []struct {
+	parity int
+	value  byte
+}{
+	{N, telnet.ParityNone},
+	{O, telnet.ParityOdd},
+	{E, telnet.ParityEven},
+	{M, telnet.ParityMark},
+	{S, telnet.ParitySpace},
+}
+
+var rfc2217Handshakes = []struct {
+	handshake int
+	value     byte
+}{
+	{NO_HANDSHAKE, telnet.ControlFlowNone},
+	{XONXOFF_HANDSHAKE, telnet.ControlFlowXonXoff},
+	{RTSCTS_HANDSHAKE, telnet.ControlFlowHardware},
+}
+
+func (rp *rfc2217Port) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
+	mode := Mode{baudrate, databits, parity, stopbits, handshake}
+	if err := mode.check(); err != nil {
+		return err
+	}
+
+	parvalue := byte(0)
+	for _, p := range rfc2217Parities {
+		if p.parity == parity {
+			parvalue = p.value
+		}
+	}
+
+	hsvalue := byte(0)
+	for _, h := range rfc2217Handshakes {
+		if h.handshake == handshake {
+			hsvalue = h.value
+		}
+	}
+	if hsvalue == 0 {
+		return &ParameterError{"handshake", "RS485_HANDSHAKE is not supported by RFC 2217"}
+	}
+
+	br := make([]byte, 4)
+	binary.BigEndian.PutUint32(br, uint32(baudrate))
+	resp, err := rp.request(telnet.SetBaudrate, br...)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(resp, br) {
+		return &Error{"rfc2217 SetMode", fmt.Errorf("server refused baud rate %d", baudrate)}
+	}
+
+	for _, s := range []struct {
+		name          string
+		subcmd, value byte
+	}{
+		{"data bits", telnet.SetDatasize, byte(databits)},
+		{"parity", telnet.SetParity, parvalue},
+		{"stop bits", telnet.SetStopsize, byte(stopbits)},
+		{"handshake", telnet.SetControl, hsvalue},
+	} {
+		got, err := rp.requestValue(s.subcmd, s.value)
+		if err != nil {
+			return err
+		}
+		if got != s.value {
+			return &Error{"rfc2217 SetMode", fmt.Errorf("server refused %s setting", s.name)}
+		}
+	}
+
+	return nil
+}
+
+func (rp *rfc2217Port) GetMode() (Mode, error) {
+	var mode Mode
+
+	resp, err := rp.request(telnet.SetBaudrate, 0, 0, 0, 0)
+	if err != nil {
+		return mode, err
+	}
+	if len(resp) != 4 {
+		return mode, &Error{"rfc2217 GetMode", fmt.Errorf("malformed baud rate %v", resp)}
+	}
+	mode.Baudrate = int(binary.BigEndian.Uint32(resp))
+
+	databits, err := rp.requestValue(telnet.SetDatasize, 0)
+	if err != nil {
+		return mode, err
+	}
+	mode.DataBits = int(databits)
+
+	stopbits, err := rp.requestValue(telnet.SetStopsize, 0)
+	if err != nil {
+		return mode, err
+	}
+	mode.Stopbits = int(stopbits)
+
+	parvalue, err := rp.requestValue(telnet.SetParity, 0)
+	if err != nil {
+		return mode, err
+	}
+	mode.Parity = -1
+	for _, p := range rfc2217Parities {
+		if p.value == parvalue {
+			mode.Parity = p.parity
+		}
+	}
+
+	hsvalue, err := rp.requestValue(telnet.SetControl, telnet.ControlFlowRequest)
+	if err != nil {
+		return mode, err
+	}
+	mode.Handshake = -1
+	for _, h := range rfc2217Handshakes {
+		if h.value == hsvalue {
+			mode.Handshake = h.handshake
+		}
+	}
+
+	if !mode.Valid() {
+		return mode, &Error{"rfc2217 GetMode", fmt.Errorf("server reported unsupported mode %v", mode)}
+	}
+	return mode, nil
+}
+
+func (rp *rfc2217Port) SetReadParams(minread int, timeout float64) error {
+	return rp.rb.setReadParams(minread, timeout)
+}
+
+// control sends a SetControl request and checks that the server confirmed
+// it.
+func (rp *rfc2217Port) control(op string, value byte) error {
+	got, err := rp.requestValue(telnet.SetControl, value)
+	if err != nil {
+		return err
+	}
+	if got != value {
+		return &Error{op, StringError("refused by server")}
+	}
+	return nil
+}
+
+func (rp *rfc2217Port) SetBreak(on bool) error {
+	if on {
+		return rp.control("setting break", telnet.ControlBreakOn)
+	}
+	return rp.control("clearing break", telnet.ControlBreakOff)
+}
+
+func (rp *rfc2217Port) SetDTR(on bool) error {
+	if on {
+		return rp.control("setting DTR", telnet.ControlDTROn)
+	}
+	return rp.control("clearing DTR", telnet.ControlDTROff)
+}
+
+func (rp *rfc2217Port) SetRTS(on bool) error {
+	if on {
+		return rp.control("setting RTS", telnet.ControlRTSOn)
+	}
+	return rp.control("clearing RTS", telnet.ControlRTSOff)
+}
+
+func (rp *rfc2217Port) SetModemLines(lines ModemLine) error {
+	if err := rp.SetDTR(lines&DTR != 0); err != nil {
+		return err
+	}
+	return rp.SetRTS(lines&RTS != 0)
+}
+
+func (rp *rfc2217Port) GetModemLines() (ModemLine, error) {
+	var lines ModemLine
+
+	dtr, err := rp.requestValue(telnet.SetControl, telnet.ControlDTRRequest)
+	if err != nil {
+		return 0, err
+	}
+	if dtr == telnet.ControlDTROn {
+		lines |= DTR
+	}
+	rts, err := rp.requestValue(telnet.SetControl, telnet.ControlRTSRequest)
+	if err != nil {
+		return 0, err
+	}
+	if rts == telnet.ControlRTSOn {
+		lines |= RTS
+	}
+
+	rp.mu.Lock()
+	modem := rp.modem
+	rp.mu.Unlock()
+	for _, l := range []struct {
+		line ModemLine
+		bit  byte
+	}{
+		{CTS, telnet.ModemCTS},
+		{DSR, telnet.ModemDSR},
+		{DCD, telnet.ModemDCD},
+		{RI, telnet.ModemRI},
+	} {
+		if modem&l.bit != 0 {
+			lines |= l.line
+		}
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,699 @@
+// Package rfc2217 implements a server for the Telnet Com Port Control
+// Option, RFC 2217, which lets remote clients use a local serial port as if
+// it were attached to their machine. Clients such as pySerial's rfc2217://
+// URLs, sers.OpenRFC2217 and terminal programs can change the baud rate and
+// frame format, set a break condition and control DTR and RTS.
+package rfc2217
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/distributed/sers"
+	"github.com/distributed/sers/internal/telnet"
+)
+
+// ErrServerClosed is returned by Serve and ServeConn after Close has been
+// called.
+var ErrServerClosed = errors.New("rfc2217: server closed")
+
+// errBusy is returned by ServeConn if another client is being served.
+var errBusy = errors.New("rfc2217: port in use by another client")
+
+// breakPulse is the length of the break condition sent for a telnet BRK.
+const breakPulse = 250 * time.Millisecond
+
+// Server serves a serial port to one RFC 2217 client at a time.
+//
+// Like a bridge.Server, the Server owns the port: the port is read as soon
+// as a client is served and closed by Close. The port's read parameters
+// should make reads block, e.g. SetReadParams(1, 0).
+//
+// Requests are mapped onto SetMode, SetBreak and, if the port implements
+// them, sers.ModemLines and sers.Flusher. Changes of the modem status lines
+// are reported to the client. Ports implementing sers.ModemWaiter are
+// watched, others are polled every ModemPollInterval.
+type Server struct {
+	Port sers.SerialPort
+
+	// Signature is sent to clients that ask for it. If empty, it is
+	// "sers".
+	Signature string
+
+	// ModemPollInterval is the interval at which the modem status lines are
+	// polled on ports that cannot wait for changes. If zero, it is one
+	// second.
+	ModemPollInterval time.Duration
+
+	// Log receives messages about clients connecting and disconnecting
+	// and about failed requests. If nil, nothing is logged.
+	Log *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	current   *session
+	reading   bool
+	closed    bool
+	portErr   error
+	resume    *sync.Cond
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on l and serves them, until Close is called,
+// reading the port fails or accepting fails. It returns ErrServerClosed,
+// the error from the port or the error from Accept, respectively. Clients
+// connecting while another one is served are disconnected. l is closed on
+// return.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if err := s.stopErr(); err != nil {
+		s.mu.Unlock()
+		l.Close()
+		return err
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			if serr := s.stopErr(); serr != nil {
+				err = serr
+			}
+			s.mu.Unlock()
+			return err
+		}
+		go func() {
+			if err := s.ServeConn(conn); err != nil && err != ErrServerClosed {
+				s.logf("%v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// stopErr returns why the server stopped, or nil if it is running. It has to
+// be called with s.mu held.
+func (s *Server) stopErr() error {
+	if s.closed {
+		return ErrServerClosed
+	}
+	return s.portErr
+}
+
+// ServeConn serves the client connected through conn until it disconnects
+// and closes conn. It returns nil if the client disconnected, and an error
+// if another client is being served or the session failed.
+func (s *Server) ServeConn(conn net.Conn) error {
+	ss := &session{
+		s:         s,
+		conn:      conn,
+		modemMask: 0xff,
+		opts: telnet.Options{
+			Local:  []byte{telnet.Binary, telnet.SuppressGA, telnet.Echo, telnet.ComPortOption},
+			Remote: []byte{telnet.Binary, telnet.SuppressGA, telnet.ComPortOption},
+		},
+		done: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	if err := s.stopErr(); err != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return err
+	}
+	if s.current != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return errBusy
+	}
+	s.current = ss
+	if s.resume == nil {
+		s.resume = sync.NewCond(&s.mu)
+	}
+	if !s.reading {
+		s.reading = true
+		go s.readPort()
+	}
+	s.mu.Unlock()
+
+	s.logf("%v connected", conn.RemoteAddr())
+	err := ss.run()
+
+	s.mu.Lock()
+	s.current = nil
+	s.resume.Broadcast()
+	if serr := s.stopErr(); serr != nil {
+		err = serr
+	}
+	s.mu.Unlock()
+	s.logf("%v disconnected", conn.RemoteAddr())
+	return err
+}
+
+// Close stops all calls to Serve, disconnects the client and closes the
+// port.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.shutdown()
+	s.mu.Unlock()
+
+	return s.Port.Close()
+}
+
+// shutdown closes listeners and the client. It has to be called with s.mu
+// held.
+func (s *Server) shutdown() {
+	for l := range s.listeners {
+		l.Close()
+	}
+	if s.current != nil {
+		s.current.conn.Close()
+	}
+	if s.resume != nil {
+		s.resume.Broadcast()
+	}
+}
+
+type timeout interface {
+	Timeout() bool
+}
+
+// readPort sends the data read from the port to the client.
+func (s *Server) readPort() {
+	buf := make([]byte, 1024)
+	for {
+		n, err := s.Port.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			// the client asked us to hold back data
+			for s.current != nil && s.current.suspended && s.stopErr() == nil {
+				s.resume.Wait()
+			}
+			ss := s.current
+			s.mu.Unlock()
+
+			if ss != nil {
+				ss.write(telnet.Escape(nil, buf[:n]))
+			}
+		}
+		if err != nil {
+			if t, ok := err.(timeout); ok && t.Timeout() {
+				continue
+			}
+
+			s.mu.Lock()
+			if !s.closed {
+				s.portErr = err
+				s.shutdown()
+			}
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// session is the connection to a client.
+type session struct {
+	s    *Server
+	conn net.Conn
+	opts telnet.Options
+	done chan struct{}
+
+	wmu sync.Mutex // serializes writes to conn
+
+	// these are only accessed by run, except for suspended, which is
+	// protected by s.mu.
+	brk       bool
+	lines     sers.ModemLine // DTR and RTS, for ports without ModemLines
+	suspended bool
+
+	// pulse is closed at the end of the break pulse requested by the
+	// last telnet BRK. Data and port commands that follow the BRK wait
+	// for it.
+	pulse chan struct{}
+
+	mmu       sync.Mutex
+	modemMask byte
+	modem     byte // modem state last reported
+}
+
+func (ss *session) write(p []byte) {
+	ss.wmu.Lock()
+	defer ss.wmu.Unlock()
+	if _, err := ss.conn.Write(p); err != nil {
+		// the read side notices as well and ends the session
+		ss.conn.Close()
+	}
+}
+
+func (ss *session) run() error {
+	defer ss.conn.Close()
+	defer close(ss.done)
+
+	ss.write(ss.opts.Request(nil))
+
+	if ml, ok := ss.s.Port.(sers.ModemLines); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go ss.watchModem(ctx, ml)
+	} else {
+		ss.lines = sers.DTR | sers.RTS
+	}
+
+	var dec telnet.Decoder
+	buf := make([]byte, 1024)
+	for {
+		n, err := ss.conn.Read(buf)
+		if n > 0 {
+			// data that precedes a command reaches the port before the
+			// command is carried out.
+			var reply []byte
+			var werr error
+			n = dec.Decode(buf[:n], func(data []byte, cmd telnet.Command) {
+				if werr == nil {
+					werr = ss.writePort(data)
+				}
+				reply = ss.handle(reply, cmd)
+			})
+			if werr == nil {
+				werr = ss.writePort(buf[:n])
+			}
+			if len(reply) > 0 {
+				ss.write(reply)
+			}
+			if werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// writePort writes data received from the client to the port.
+func (ss *session) writePort(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	ss.waitPulse()
+	_, err := ss.s.Port.Write(p)
+	return err
+}
+
+// waitPulse waits for the end of a break pulse in progress.
+func (ss *session) waitPulse() {
+	if ss.pulse != nil {
+		<-ss.pulse
+		ss.pulse = nil
+	}
+}
+
+func (ss *session) handle(reply []byte, cmd telnet.Command) []byte {
+	switch cmd.Verb {
+	case telnet.WILL, telnet.WONT, telnet.DO, telnet.DONT:
+		return ss.opts.Handle(reply, cmd.Verb, cmd.Option)
+	case telnet.BRK:
+		// a telnet break, not to be confused with a break condition
+		// requested through SetControl, is turned into a short pulse.
+		// It ends on a timer, so that option negotiation and replies
+		// carry on while it lasts.
+		ss.waitPulse()
+		if err := ss.s.Port.SetBreak(true); err == nil {
+			pulse := make(chan struct{})
+			time.AfterFunc(breakPulse, func() {
+				ss.s.Port.SetBreak(false)
+				close(pulse)
+			})
+			ss.pulse = pulse
+		}
+	case telnet.SB:
+		if cmd.Option == telnet.ComPortOption && len(cmd.Params) > 0 {
+			ss.waitPulse()
+			return ss.comPort(reply, cmd.Params[0], cmd.Params[1:])
+		}
+	}
+	return reply
+}
+
+// mode returns the current mode of the port. Ports that cannot tell, such
+// as those on OS X before SetMode has been called, are assumed to be set to
+// 9600,8n1.
+func (ss *session) mode() sers.Mode {
+	mode, err := ss.s.Port.GetMode()
+	if err != nil {
+		return sers.Mode{Baudrate: 9600, DataBits: 8, Parity: sers.N, Stopbits: 1, Handshake: sers.NO_HANDSHAKE}
+	}
+	return mode
+}
+
+// setMode applies the modification of the current mode made by change. If
+// SetMode fails, the error is logged and the reply, which reports the
+// resulting mode, tells the client.
+func (ss *session) setMode(change func(*sers.Mode)) sers.Mode {
+	mode := ss.mode()
+	change(&mode)
+	if err := sers.SetModeStruct(ss.s.Port, mode); err != nil {
+		ss.s.logf("%v: setting mode %v: %v", ss.conn.RemoteAddr(), mode, err)
+	}
+	return ss.mode()
+}
+
+var parities = []struct {
+	parity, value int
+}{
+	{sers.N, telnet.ParityNone},
+	{sers.O, telnet.ParityOdd},
+	{sers.E, telnet.ParityEven},
+	{sers.M, telnet.ParityMark},
+	{sers.S, telnet.ParitySpace},
+}
+
+var handshakes = []struct {
+	handshake, value int
+}{
+	{sers.NO_HANDSHAKE, telnet.ControlFlowNone},
+	{sers.XONXOFF_HANDSHAKE, telnet.ControlFlowXonXoff},
+	{sers.RTSCTS_HANDSHAKE, telnet.ControlFlowHardware},
+}
+
+// comPort carries out a subcommand of the Com Port Control Option and
+// appends the response to reply.
+func (ss *session) comPort(reply []byte, subcmd byte, params []byte) []byte {
+	respond := func(params ...byte) []byte {
+		return append(reply, telnet.Subnegotiation(telnet.ComPortOption, append([]byte{subcmd + telnet.ServerOffset}, params...)...)...)
+	}
+	value := byte(0)
+	if len(params) > 0 {
+		value = params[0]
+	}
+
+	switch subcmd {
+	case telnet.Signature:
+		if len(params) > 0 {
+			ss.s.logf("%v: client signature %q", ss.conn.RemoteAddr(), params)
+			return reply
+		}
+		sig := ss.s.Signature
+		if sig == "" {
+			sig = "sers"
+		}
+		return respond([]byte(sig)...)
+
+	case telnet.SetBaudrate:
+		if len(params) != 4 {
+			return reply
+		}
+		mode := ss.mode()
+		if br := binary.BigEndian.Uint32(params); br != 0 {
+			mode = ss.setMode(func(m *sers.Mode) { m.Baudrate = int(br) })
+		}
+		buf := make([]byte, 4)
+		binary.BigEndian.PutUint32(buf, uint32(mode.Baudrate))
+		return respond(buf...)
+
+	case telnet.SetDatasize:
+		mode := ss.mode()
+		if value != 0 {
+			mode = ss.setMode(func(m *sers.Mode) { m.DataBits = int(value) })
+		}
+		return respond(byte(mode.DataBits))
+
+	case telnet.SetParity:
+		mode := ss.mode()
+		for _, p := range parities {
+			if int(value) == p.value {
+				mode = ss.setMode(func(m *sers.Mode) { m.Parity = p.parity })
+			}
+		}
+		for _, p := range parities {
+			if mode.Parity == p.parity {
+				return respond(byte(p.value))
+			}
+		}
+
+	case telnet.SetStopsize:
+		mode := ss.mode()
+		if value == telnet.Stopsize1 || value == telnet.Stopsize2 {
+			mode = ss.setMode(func(m *sers.Mode) { m.Stopbits = int(value) })
+		}
+		return respond(byte(mode.Stopbits))
+
+	case telnet.SetControl:
+		return respond(ss.control(value))
+
+	case telnet.NotifyLinestate:
+		// line state is not tracked
+		return respond(0)
+
+	case telnet.NotifyModemstate:
+		lines, _ := ss.getModemLines()
+		ss.mmu.Lock()
+		ss.modem = modemState(lines)
+		mask := ss.modemMask
+		ss.mmu.Unlock()
+		return append(reply, telnet.Subnegotiation(telnet.ComPortOption, telnet.NotifyModemstate+telnet.ServerOffset, modemState(lines)&mask)...)
+
+	case telnet.FlowcontrolSuspend, telnet.FlowcontrolResume:
+		ss.s.mu.Lock()
+		ss.suspended = subcmd == telnet.FlowcontrolSuspend
+		ss.s.resume.Broadcast()
+		ss.s.mu.Unlock()
+		return respond()
+
+	case telnet.SetLinestateMask:
+		return respond(value)
+
+	case telnet.SetModemstateMask:
+		ss.mmu.Lock()
+		ss.modemMask = value
+		ss.mmu.Unlock()
+		return respond(value)
+
+	case telnet.PurgeData:
+		if fl, ok := ss.s.Port.(sers.Flusher); ok {
+			if value == telnet.PurgeReceive || value == telnet.PurgeBoth {
+				fl.FlushInput()
+			}
+			if value == telnet.PurgeTransmit || value == telnet.PurgeBoth {
+				fl.FlushOutput()
+			}
+		}
+		return respond(value)
+	}
+
+	return reply
+}
+
+// control carries out a SetControl request and returns the value of the
+// response.
+func (ss *session) control(value byte) byte {
+	switch value {
+	case telnet.ControlFlowNone, telnet.ControlFlowXonXoff, telnet.ControlFlowHardware,
+		telnet.ControlInFlowNone, telnet.ControlInFlowXonXoff, telnet.ControlInFlowHardware:
+		// the port has one setting for both directions
+		v := int(value)
+		if value >= telnet.ControlInFlowNone {
+			v -= telnet.ControlInFlowNone - telnet.ControlFlowNone
+		}
+		for _, h := range handshakes {
+			if v == h.value {
+				ss.setMode(func(m *sers.Mode) { m.Handshake = h.handshake })
+			}
+		}
+		fallthrough
+	case telnet.ControlFlowRequest, telnet.ControlInFlowRequest:
+		mode := ss.mode()
+		result := byte(telnet.ControlFlowNone)
+		for _, h := range handshakes {
+			if mode.Handshake == h.handshake {
+				result = byte(h.value)
+			}
+		}
+		if value >= telnet.ControlInFlowRequest {
+			result += telnet.ControlInFlowNone - telnet.ControlFlowNone
+		}
+		return result
+
+	case telnet.ControlBreakOn, telnet.ControlBreakOff:
+		on := value == telnet.ControlBreakOn
+		if err := ss.s.Port.SetBreak(on); err != nil {
+			ss.s.logf("%v: setting break: %v", ss.conn.RemoteAddr(), err)
+		} else {
+			ss.brk = on
+		}
+		fallthrough
+	case telnet.ControlBreakRequest:
+		if ss.brk {
+			return telnet.ControlBreakOn
+		}
+		return telnet.ControlBreakOff
+
+	case telnet.ControlDTROn, telnet.ControlDTROff:
+		ss.setModemLine(sers.DTR, value == telnet.ControlDTROn)
+		fallthrough
+	case telnet.ControlDTRRequest:
+		if lines, _ := ss.getModemLines(); lines&sers.DTR != 0 {
+			return telnet.ControlDTROn
+		}
+		return telnet.ControlDTROff
+
+	case telnet.ControlRTSOn, telnet.ControlRTSOff:
+		ss.setModemLine(sers.RTS, value == telnet.ControlRTSOn)
+		fallthrough
+	case telnet.ControlRTSRequest:
+		if lines, _ := ss.getModemLines(); lines&sers.RTS != 0 {
+			return telnet.ControlRTSOn
+		}
+		return telnet.ControlRTSOff
+	}
+
+	// DCD, DTR and DSR flow control are not supported
+	return ss.control(telnet.ControlFlowRequest)
+}
+
+func (ss *session) getModemLines() (sers.ModemLine, error) {
+	if ml, ok := ss.s.Port.(sers.ModemLines); ok {
+		return ml.GetModemLines()
+	}
+	return ss.lines, nil
+}
+
+func (ss *session) setModemLine(line sers.ModemLine, on bool) {
+	ml, ok := ss.s.Port.(sers.ModemLines)
+	if !ok {
+		if on {
+			ss.lines |= line
+		} else {
+			ss.lines &^= line
+		}
+		return
+	}
+
+	var err error
+	if line == sers.DTR {
+		err = ml.SetDTR(on)
+	} else {
+		err = ml.SetRTS(on)
+	}
+	if err != nil {
+		ss.s.logf("%v: setting %v: %v", ss.conn.RemoteAddr(), line, err)
+	}
+}
+
+// modemState returns the state bits of NotifyModemstate for lines.
+func modemState(lines sers.ModemLine) byte {
+	var state byte
+	for _, l := range []struct {
+		line sers.ModemLine
+		bit  byte
+	}{
+		{sers.CTS, telnet.ModemCTS},
+		{sers.DSR, telnet.ModemDSR},
+		{sers.RI, telnet.ModemRI},
+		{sers.DCD, telnet.ModemDCD},
+	} {
+		if lines&l.line != 0 {
+			state |= l.bit
+		}
+	}
+	return state
+}
+
+// watchModem reports changes of the modem status lines to the client.
+func (ss *session) watchModem(ctx context.Context, ml sers.ModemLines) {
+	lines, err := ml.GetModemLines()
+	if err != nil {
+		return
+	}
+	ss.mmu.Lock()
+	ss.modem = modemState(lines)
+	ss.mmu.Unlock()
+
+	if mw, ok := ml.(sers.ModemWaiter); ok {
+		for ev := range sers.WatchModemLines(ctx, mw, sers.CTS|sers.DSR|sers.DCD|sers.RI) {
+			if ev.Err != nil {
+				return
+			}
+			ss.notifyModem(ev.Lines, ev.Changed)
+		}
+		return
+	}
+
+	interval := ss.s.ModemPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ss.done:
+			return
+		}
+		lines, err := ml.GetModemLines()
+		if err != nil {
+			return
+		}
+		ss.notifyModem(lines, 0)
+	}
+}
+
+// notifyModem sends a NotifyModemstate to the client if any of the lines
+// in the client's mask changed since the last report. changed contains lines
+// known to have changed, even if their state is the same again.
+func (ss *session) notifyModem(lines, changed sers.ModemLine) {
+	ss.mmu.Lock()
+	state := modemState(lines)
+	delta := (state ^ ss.modem) | modemState(changed)
+	ss.modem = state
+	mask := ss.modemMask
+	ss.mmu.Unlock()
+
+	// the delta bits are the state bits shifted down by four, except for
+	// RI, which reports the trailing edge only.
+	value := state | delta>>4
+	if delta&telnet.ModemRI != 0 && state&telnet.ModemRI != 0 {
+		value &^= telnet.ModemTrailingRI
+	}
+	if (delta|delta>>4)&mask == 0 {
+		return
+	}
+	ss.write(telnet.Subnegotiation(telnet.ComPortOption, telnet.NotifyModemstate+telnet.ServerOffset, value&mask))
+}
@@ -0,0 +1,306 @@
+package rfc2217
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+	"github.com/distributed/sers/internal/telnet"
+)
+
+// testClient is a minimal RFC 2217 client that separates data from
+// responses.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	data chan []byte
+	cmds chan telnet.Command
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &testClient{
+		t:    t,
+		conn: conn,
+		data: make(chan []byte, 100),
+		cmds: make(chan telnet.Command, 100),
+	}
+	go func() {
+		defer close(tc.cmds)
+		var dec telnet.Decoder
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			n = dec.Decode(buf[:n], func(data []byte, cmd telnet.Command) {
+				if len(data) > 0 {
+					tc.data <- append([]byte(nil), data...)
+				}
+				tc.cmds <- cmd
+			})
+			if n > 0 {
+				tc.data <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return tc
+}
+
+func (tc *testClient) send(p ...byte) {
+	tc.t.Helper()
+	if _, err := tc.conn.Write(p); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// expect waits for a ComPortOption subnegotiation and compares it to exp,
+// skipping option negotiation.
+func (tc *testClient) expect(exp ...byte) {
+	tc.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case cmd, ok := <-tc.cmds:
+			if !ok {
+				tc.t.Fatalf("connection closed waiting for %v", exp)
+			}
+			if cmd.Verb != telnet.SB {
+				continue
+			}
+			if cmd.Option != telnet.ComPortOption || !bytes.Equal(cmd.Params, exp) {
+				tc.t.Fatalf("got subnegotiation %d %v, want %v", cmd.Option, cmd.Params, exp)
+			}
+			return
+		case <-timeout:
+			tc.t.Fatalf("timeout waiting for %v", exp)
+		}
+	}
+}
+
+func (tc *testClient) request(subcmd byte, params ...byte) {
+	tc.t.Helper()
+	tc.send(telnet.Subnegotiation(telnet.ComPortOption, append([]byte{subcmd}, params...)...)...)
+}
+
+func (tc *testClient) expectData(exp []byte) {
+	tc.t.Helper()
+	var got []byte
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(exp) {
+		select {
+		case p := <-tc.data:
+			got = append(got, p...)
+		case <-timeout:
+			tc.t.Fatalf("got data %v, want %v", got, exp)
+		}
+	}
+	if !bytes.Equal(got, exp) {
+		tc.t.Errorf("got data %v, want %v", got, exp)
+	}
+}
+
+func TestServer(t *testing.T) {
+	pp, err := sers.OpenPTYPair()
+	if err != nil {
+		t.Skipf("no pseudo terminals available: %v", err)
+	}
+	defer pp.Master.Close()
+	device := pp.Master
+	if err := device.SetReadParams(0, 2.0); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Port: pp.Slave, Signature: "test server"}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	tc := dial(t, l.Addr().String())
+	defer tc.conn.Close()
+	tc.send(telnet.IAC, telnet.WILL, telnet.ComPortOption, telnet.IAC, telnet.DO, telnet.ComPortOption)
+
+	tc.request(telnet.Signature)
+	tc.expect(append([]byte{telnet.Signature + telnet.ServerOffset}, "test server"...)...)
+
+	// 19200 baud
+	tc.request(telnet.SetBaudrate, 0, 0, 0x4b, 0)
+	tc.expect(telnet.SetBaudrate+telnet.ServerOffset, 0, 0, 0x4b, 0)
+	if mode, err := pp.Slave.GetMode(); err != nil || mode.Baudrate != 19200 {
+		t.Errorf("port mode %v, %v after setting 19200 baud", mode, err)
+	}
+	tc.request(telnet.SetBaudrate, 0, 0, 0, 0)
+	tc.expect(telnet.SetBaudrate+telnet.ServerOffset, 0, 0, 0x4b, 0)
+
+	tc.request(telnet.SetStopsize, telnet.Stopsize2)
+	tc.expect(telnet.SetStopsize+telnet.ServerOffset, telnet.Stopsize2)
+	tc.request(telnet.SetControl, telnet.ControlFlowHardware)
+	tc.expect(telnet.SetControl+telnet.ServerOffset, telnet.ControlFlowHardware)
+	tc.request(telnet.SetControl, telnet.ControlInFlowRequest)
+	tc.expect(telnet.SetControl+telnet.ServerOffset, telnet.ControlInFlowHardware)
+	exp := sers.Mode{Baudrate: 19200, DataBits: 8, Parity: sers.N, Stopbits: 2, Handshake: sers.RTSCTS_HANDSHAKE}
+	if mode, err := pp.Slave.GetMode(); err != nil || mode != exp {
+		t.Errorf("port mode %v, %v, want %v", mode, err, exp)
+	}
+
+	// pseudo terminals do not do parity, the reply tells the client
+	tc.request(telnet.SetParity, telnet.ParityEven)
+	tc.expect(telnet.SetParity+telnet.ServerOffset, telnet.ParityNone)
+
+	// data in both directions, with IAC escaped
+	msg := []byte{'a', 0xff, 'b'}
+	tc.send(telnet.Escape(nil, msg)...)
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(device, buf); err != nil || !bytes.Equal(buf, msg) {
+		t.Errorf("device read %v, %v, want %v", buf, err, msg)
+	}
+	if _, err := device.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	tc.expectData(msg)
+
+	// modem lines, connected through the emulated null modem
+	dml := device.(sers.ModemLines)
+	tc.request(telnet.SetControl, telnet.ControlDTROff)
+	tc.expect(telnet.SetControl+telnet.ServerOffset, telnet.ControlDTROff)
+	if lines, _ := dml.GetModemLines(); lines&(sers.DSR|sers.DCD) != 0 {
+		t.Errorf("device sees %v after DTR off", lines)
+	}
+	tc.request(telnet.SetControl, telnet.ControlDTRRequest)
+	tc.expect(telnet.SetControl+telnet.ServerOffset, telnet.ControlDTROff)
+
+	tc.request(telnet.NotifyModemstate)
+	tc.expect(telnet.NotifyModemstate+telnet.ServerOffset, telnet.ModemCTS|telnet.ModemDSR|telnet.ModemDCD)
+	if err := dml.SetRTS(false); err != nil {
+		t.Fatal(err)
+	}
+	tc.expect(telnet.NotifyModemstate+telnet.ServerOffset, telnet.ModemDSR|telnet.ModemDCD|telnet.ModemDeltaCTS)
+
+	tc.request(telnet.SetModemstateMask, telnet.ModemDSR)
+	tc.expect(telnet.SetModemstateMask+telnet.ServerOffset, telnet.ModemDSR)
+	dml.SetRTS(true)
+	dml.SetDTR(false)
+	tc.expect(telnet.NotifyModemstate+telnet.ServerOffset, 0)
+
+	tc.request(telnet.SetControl, telnet.ControlBreakOn)
+	tc.expect(telnet.SetControl+telnet.ServerOffset, telnet.ControlBreakOn)
+	tc.request(telnet.SetControl, telnet.ControlBreakOff)
+	tc.expect(telnet.SetControl+telnet.ServerOffset, telnet.ControlBreakOff)
+
+	tc.request(telnet.PurgeData, telnet.PurgeBoth)
+	tc.expect(telnet.PurgeData+telnet.ServerOffset, telnet.PurgeBoth)
+
+	// one client at a time
+	tc2 := dial(t, l.Addr().String())
+	defer tc2.conn.Close()
+	select {
+	case p := <-tc2.data:
+		t.Errorf("second client received %v", p)
+	case cmd, ok := <-tc2.cmds:
+		if ok {
+			t.Errorf("second client received %v", cmd)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("second client not disconnected")
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-served:
+		if err != ErrServerClosed {
+			t.Errorf("Serve returned %v, want %v", err, ErrServerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
+
+// orderPort records the order of writes, mode changes and breaks.
+type orderPort struct {
+	sers.SerialPort
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (op *orderPort) record(ev string) {
+	op.mu.Lock()
+	op.events = append(op.events, ev)
+	op.mu.Unlock()
+}
+
+func (op *orderPort) Write(p []byte) (int, error) {
+	op.record("write " + string(p))
+	return op.SerialPort.Write(p)
+}
+
+func (op *orderPort) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
+	op.record(fmt.Sprintf("mode %d", baudrate))
+	return op.SerialPort.SetMode(baudrate, databits, parity, stopbits, handshake)
+}
+
+func (op *orderPort) SetBreak(on bool) error {
+	op.record(fmt.Sprintf("break %v", on))
+	return op.SerialPort.SetBreak(on)
+}
+
+func TestServerOrder(t *testing.T) {
+	pp, err := sers.OpenPTYPair()
+	if err != nil {
+		t.Skipf("no pseudo terminals available: %v", err)
+	}
+	defer pp.Master.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := &orderPort{SerialPort: pp.Slave}
+	srv := &Server{Port: port}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	tc := dial(t, l.Addr().String())
+	defer tc.conn.Close()
+
+	// data, a mode change, a telnet break and more data in a single write
+	var p []byte
+	p = append(p, "ab"...)
+	p = append(p, telnet.Subnegotiation(telnet.ComPortOption, telnet.SetBaudrate, 0, 0, 0x25, 0x80)...)
+	p = append(p, "cd"...)
+	p = append(p, telnet.IAC, telnet.BRK)
+	p = append(p, "ef"...)
+	tc.send(p...)
+	tc.expect(telnet.SetBaudrate+telnet.ServerOffset, 0, 0, 0x25, 0x80)
+
+	exp := []string{"write ab", "mode 9600", "write cd", "break true", "break false", "write ef"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		port.mu.Lock()
+		got := append([]string(nil), port.events...)
+		port.mu.Unlock()
+		if len(got) >= len(exp) || time.Now().After(deadline) {
+			if !reflect.DeepEqual(got, exp) {
+				t.Errorf("port saw %q, want %q", got, exp)
+			}
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
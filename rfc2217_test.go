@@ -0,0 +1,202 @@
+package sers_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+	"github.com/distributed/sers/rfc2217"
+)
+
+// serveRFC2217 serves the slave of a pty pair through an in-process
+// RFC 2217 server and returns the master, which plays the device, along
+// with the address of the server.
+func serveRFC2217(t *testing.T) (device sers.SerialPort, addr string, closeAll func()) {
+	pp, err := sers.OpenPTYPair()
+	if err != nil {
+		t.Skipf("no pseudo terminals available: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		pp.Close()
+		t.Fatal(err)
+	}
+
+	srv := &rfc2217.Server{Port: pp.Slave}
+	go srv.Serve(l)
+	return pp.Master, l.Addr().String(), func() {
+		srv.Close()
+		pp.Master.Close()
+	}
+}
+
+func TestRFC2217Mode(t *testing.T) {
+	_, addr, closeAll := serveRFC2217(t)
+	defer closeAll()
+
+	sp, err := sers.OpenRFC2217(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	for _, mode := range []sers.Mode{
+		{19200, 8, sers.N, 2, sers.RTSCTS_HANDSHAKE},
+		{250000, 8, sers.N, 1, sers.XONXOFF_HANDSHAKE},
+		{9600, 8, sers.N, 1, sers.NO_HANDSHAKE},
+	} {
+		if err := sers.SetModeStruct(sp, mode); err != nil {
+			t.Errorf("SetMode(%v): %v", mode, err)
+			continue
+		}
+		got, err := sp.GetMode()
+		if err != nil || got != mode {
+			t.Errorf("GetMode after SetMode(%v) = %v, %v", mode, got, err)
+		}
+	}
+
+	// the pseudo terminal on the server's end refuses parity
+	if err := sp.SetMode(9600, 8, sers.E, 1, sers.NO_HANDSHAKE); err == nil {
+		t.Error("SetMode with even parity succeeded")
+	}
+
+	for _, mode := range []sers.Mode{
+		{0, 8, sers.N, 1, sers.NO_HANDSHAKE},
+		{9600, 9, sers.N, 1, sers.NO_HANDSHAKE},
+		{9600, 8, 'X', 1, sers.NO_HANDSHAKE},
+		{9600, 8, sers.N, 3, sers.NO_HANDSHAKE},
+		{9600, 8, sers.N, 1, sers.RS485_HANDSHAKE},
+	} {
+		err := sers.SetModeStruct(sp, mode)
+		if _, ok := err.(*sers.ParameterError); !ok {
+			t.Errorf("SetMode(%v) returned %v, want *ParameterError", mode, err)
+		}
+	}
+
+	if err := sp.SetBreak(true); err != nil {
+		t.Error(err)
+	}
+	if err := sp.SetBreak(false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRFC2217Data(t *testing.T) {
+	device, addr, closeAll := serveRFC2217(t)
+	defer closeAll()
+
+	sp, err := sers.OpenRFC2217(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	msg := []byte{'a', 0xff, 0, '\r', '\n', 0xff, 'b'}
+	if _, err := sp.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.SetReadParams(0, 2.0); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(device, buf); err != nil || !bytes.Equal(buf, msg) {
+		t.Errorf("device read %v, %v, want %v", buf, err, msg)
+	}
+
+	if _, err := device.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.SetReadParams(len(msg), 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := sp.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Errorf("Read returned %v, %v, want %v", buf[:n], err, msg)
+	}
+
+	// read timeout
+	if err := sp.SetReadParams(0, 0.2); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	n, err = sp.Read(buf)
+	if to, ok := err.(interface{ Timeout() bool }); n != 0 || !ok || !to.Timeout() {
+		t.Errorf("Read returned %d, %v, want timeout", n, err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond || d > 2*time.Second {
+		t.Errorf("Read timed out after %v, want about 200ms", d)
+	}
+
+	sp.Close()
+	if _, err := sp.Read(buf); err == nil {
+		t.Error("Read after Close succeeded")
+	}
+}
+
+func TestRFC2217ModemLines(t *testing.T) {
+	device, addr, closeAll := serveRFC2217(t)
+	defer closeAll()
+
+	sp, err := sers.OpenRFC2217(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	ml := sp.(sers.ModemLines)
+	dml := device.(sers.ModemLines)
+
+	expect := func(exp sers.ModemLine) {
+		t.Helper()
+		var lines sers.ModemLine
+		// status lines are updated by notifications
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			lines, err = ml.GetModemLines()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines == exp {
+				return
+			}
+		}
+		t.Errorf("got modem lines %v, want %v", lines, exp)
+	}
+
+	expect(sers.DTR | sers.RTS | sers.CTS | sers.DSR | sers.DCD)
+
+	if err := ml.SetDTR(false); err != nil {
+		t.Fatal(err)
+	}
+	if lines, _ := dml.GetModemLines(); lines&(sers.DSR|sers.DCD) != 0 {
+		t.Errorf("device sees %v after DTR off", lines)
+	}
+
+	if err := dml.SetRTS(false); err != nil {
+		t.Fatal(err)
+	}
+	expect(sers.RTS | sers.DSR | sers.DCD)
+
+	if err := ml.SetModemLines(sers.DTR); err != nil {
+		t.Fatal(err)
+	}
+	expect(sers.DTR | sers.DSR | sers.DCD)
+}
+
+func TestRFC2217URL(t *testing.T) {
+	_, addr, closeAll := serveRFC2217(t)
+	defer closeAll()
+
+	sp, err := sers.Open("rfc2217://" + addr + "?mode=57600,8n2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	exp := sers.Mode{57600, 8, sers.N, 2, sers.NO_HANDSHAKE}
+	if mode, err := sp.GetMode(); err != nil || mode != exp {
+		t.Errorf("GetMode() = %v, %v, want %v", mode, err, exp)
+	}
+}
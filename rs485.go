@@ -0,0 +1,47 @@
+package sers
+
+import "time"
+
+// RS485Config configures the driver-controlled RS-485 mode of a serial port.
+// In this mode, the driver switches the transceiver between sending and
+// receiving by means of the RTS line.
+type RS485Config struct {
+	// Enabled turns RS-485 mode on.
+	Enabled bool
+
+	// RTSOnSend is the level of RTS while sending, RTSAfterSend the level
+	// of RTS after sending. Usually exactly one of them is set.
+	RTSOnSend    bool
+	RTSAfterSend bool
+
+	// DelayRTSBeforeSend is the time between switching RTS to the sending
+	// level and sending the first bit, DelayRTSAfterSend the time between
+	// the last bit and switching RTS back. The driver works with
+	// millisecond resolution.
+	DelayRTSBeforeSend time.Duration
+	DelayRTSAfterSend  time.Duration
+
+	// RxDuringTx enables the receiver while sending, so that the sent data
+	// is echoed back.
+	RxDuringTx bool
+
+	// TerminateBus enables the bus termination, if the hardware supports
+	// switching it.
+	TerminateBus bool
+}
+
+// RS485 is implemented by serial ports that support configuration of the
+// driver's RS-485 mode. On Linux, the serial ports returned by Open implement
+// it, but whether the mode can actually be used depends on the driver.
+//
+// Setting the handshake to RS485_HANDSHAKE through SetMode is a shorthand for
+// enabling RS-485 mode with the current delays. Switching from it to another
+// handshake setting disables it again. RS-485 mode enabled through SetRS485 is
+// not affected by other handshake settings.
+type RS485 interface {
+	// SetRS485 configures the RS-485 mode.
+	SetRS485(conf RS485Config) error
+
+	// GetRS485 retrieves the current RS-485 configuration.
+	GetRS485() (RS485Config, error)
+}
@@ -0,0 +1,119 @@
+// +build linux
+
+package sers
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var _ RS485 = (*baseport)(nil)
+
+// serialRS485 is the kernel's struct serial_rs485.
+type serialRS485 struct {
+	Flags              uint32
+	DelayRTSBeforeSend uint32
+	DelayRTSAfterSend  uint32
+	Padding            [5]uint32
+}
+
+const (
+	serRS485Enabled      = 1 << 0
+	serRS485RTSOnSend    = 1 << 1
+	serRS485RTSAfterSend = 1 << 2
+	serRS485RxDuringTx   = 1 << 4
+	serRS485TerminateBus = 1 << 5
+)
+
+func (bp *baseport) SetRS485(conf RS485Config) error {
+	if conf.DelayRTSBeforeSend < 0 {
+		return &ParameterError{"DelayRTSBeforeSend", "needs to be 0 or higher"}
+	}
+	if conf.DelayRTSAfterSend < 0 {
+		return &ParameterError{"DelayRTSAfterSend", "needs to be 0 or higher"}
+	}
+
+	var rs serialRS485
+	if conf.Enabled {
+		rs.Flags |= serRS485Enabled
+	}
+	if conf.RTSOnSend {
+		rs.Flags |= serRS485RTSOnSend
+	}
+	if conf.RTSAfterSend {
+		rs.Flags |= serRS485RTSAfterSend
+	}
+	if conf.RxDuringTx {
+		rs.Flags |= serRS485RxDuringTx
+	}
+	if conf.TerminateBus {
+		rs.Flags |= serRS485TerminateBus
+	}
+	rs.DelayRTSBeforeSend = uint32(conf.DelayRTSBeforeSend / time.Millisecond)
+	rs.DelayRTSAfterSend = uint32(conf.DelayRTSAfterSend / time.Millisecond)
+
+	return bp.rs485.configure(func() error {
+		if err := bp.ioctl(ioctlTIOCSRS485, unsafe.Pointer(&rs)); err != nil {
+			return &Error{"ioctl: setting RS-485 configuration", err}
+		}
+		return nil
+	})
+}
+
+func (bp *baseport) GetRS485() (RS485Config, error) {
+	var rs serialRS485
+	if err := bp.ioctl(ioctlTIOCGRS485, unsafe.Pointer(&rs)); err != nil {
+		return RS485Config{}, &Error{"ioctl: getting RS-485 configuration", err}
+	}
+
+	return RS485Config{
+		Enabled:            rs.Flags&serRS485Enabled != 0,
+		RTSOnSend:          rs.Flags&serRS485RTSOnSend != 0,
+		RTSAfterSend:       rs.Flags&serRS485RTSAfterSend != 0,
+		DelayRTSBeforeSend: time.Duration(rs.DelayRTSBeforeSend) * time.Millisecond,
+		DelayRTSAfterSend:  time.Duration(rs.DelayRTSAfterSend) * time.Millisecond,
+		RxDuringTx:         rs.Flags&serRS485RxDuringTx != 0,
+		TerminateBus:       rs.Flags&serRS485TerminateBus != 0,
+	}, nil
+}
+
+// setRS485Mode enables or disables RS-485 mode as part of SetMode. It reports
+// whether the mode of the driver has changed.
+func (bp *baseport) setRS485Mode(on bool) (bool, error) {
+	var rs serialRS485
+	err := bp.ioctl(ioctlTIOCGRS485, unsafe.Pointer(&rs))
+	if err == syscall.ENOTTY && !on {
+		// the driver has no RS-485 support, so it's not enabled.
+		return false, nil
+	}
+	if err != nil {
+		return false, &Error{"ioctl: getting RS-485 configuration", err}
+	}
+
+	if (rs.Flags&serRS485Enabled != 0) == on {
+		return false, nil
+	}
+
+	rs.Flags &^= serRS485Enabled
+	if on {
+		rs.Flags |= serRS485Enabled
+		if rs.Flags&(serRS485RTSOnSend|serRS485RTSAfterSend) == 0 {
+			rs.Flags |= serRS485RTSOnSend
+		}
+	}
+
+	if err := bp.ioctl(ioctlTIOCSRS485, unsafe.Pointer(&rs)); err != nil {
+		return false, &Error{"ioctl: setting RS-485 configuration", err}
+	}
+
+	return true, nil
+}
+
+func (bp *baseport) rs485Enabled() bool {
+	var rs serialRS485
+	if err := bp.ioctl(ioctlTIOCGRS485, unsafe.Pointer(&rs)); err != nil {
+		return false
+	}
+	return rs.Flags&serRS485Enabled != 0
+}
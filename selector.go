@@ -0,0 +1,190 @@
+package sers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PortSelector selects serial ports by attributes of their hardware rather
+// than by device path, which may change whenever a device is plugged in.
+// Fields with their zero value match any port, except for Interface where
+// this is the case for -1.
+//
+// The textual form, accepted by ParsePortSelector and Open, starts with
+// "usb:", optionally followed by the hexadecimal vendor and product ID and by
+// key=value pairs, all separated by colons. Valid keys are "serial",
+// "interface", "by-id" and "by-path". The values of the latter two extend to
+// the end of the string, as they may contain colons themselves. Examples:
+//
+//	usb:0403:6001                   - any FTDI FT232R adapter
+//	usb:0403:6001:serial=A12345     - the FT232R with serial number A12345
+//	usb:0403:6010:interface=1       - the second port of an FT2232 adapter
+//	usb:serial=A12345               - any USB adapter with serial number A12345
+//	usb:by-path=pci-0000:00:14.0-usb-0:2:1.0-port0
+//	                                - the adapter plugged into a certain port
+type PortSelector struct {
+	VID          uint16
+	PID          uint16
+	SerialNumber string
+	Interface    int
+	// ByID and ByPath match the name of a symlink in /dev/serial/by-id
+	// and /dev/serial/by-path, respectively.
+	ByID   string
+	ByPath string
+}
+
+const selectorPrefix = "usb:"
+
+// IsPortSelector reports whether s is a port selector rather than a device
+// path.
+func IsPortSelector(s string) bool {
+	return strings.HasPrefix(s, selectorPrefix)
+}
+
+// ParsePortSelector parses the textual form of a PortSelector.
+func ParsePortSelector(s string) (PortSelector, error) {
+	sel := PortSelector{Interface: -1}
+	if !IsPortSelector(s) {
+		return sel, fmt.Errorf("port selector %q does not start with %q", s, selectorPrefix)
+	}
+
+	rest := s[len(selectorPrefix):]
+	positional := 0
+	for rest != "" {
+		var field string
+		if strings.HasPrefix(rest, "by-id=") || strings.HasPrefix(rest, "by-path=") {
+			field, rest = rest, ""
+		} else if idx := strings.IndexByte(rest, ':'); idx >= 0 {
+			field, rest = rest[:idx], rest[idx+1:]
+		} else {
+			field, rest = rest, ""
+		}
+
+		eq := strings.IndexByte(field, '=')
+		if eq < 0 {
+			id, err := strconv.ParseUint(field, 16, 16)
+			if err != nil || positional >= 2 {
+				return sel, fmt.Errorf("port selector %q: cannot parse %q as vendor or product ID", s, field)
+			}
+			if positional == 0 {
+				sel.VID = uint16(id)
+			} else {
+				sel.PID = uint16(id)
+			}
+			positional++
+			continue
+		}
+
+		// IDs have to come first
+		positional = 2
+
+		key, value := field[:eq], field[eq+1:]
+		switch key {
+		case "serial":
+			sel.SerialNumber = value
+		case "interface":
+			n, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				return sel, fmt.Errorf("port selector %q: cannot parse interface number %q", s, value)
+			}
+			sel.Interface = int(n)
+		case "by-id":
+			sel.ByID = filepath.Base(value)
+		case "by-path":
+			sel.ByPath = filepath.Base(value)
+		default:
+			return sel, fmt.Errorf("port selector %q: unknown key %q", s, key)
+		}
+	}
+
+	return sel, nil
+}
+
+// Matches reports whether the port described by pi is selected.
+func (sel PortSelector) Matches(pi *PortInfo) bool {
+	if sel.VID != 0 && sel.VID != pi.VID {
+		return false
+	}
+	if sel.PID != 0 && sel.PID != pi.PID {
+		return false
+	}
+	if sel.SerialNumber != "" && sel.SerialNumber != pi.SerialNumber {
+		return false
+	}
+	if sel.Interface >= 0 && sel.Interface != pi.Interface {
+		return false
+	}
+	if sel.ByID != "" && !hasLink(pi.ByID, sel.ByID) {
+		return false
+	}
+	if sel.ByPath != "" && !hasLink(pi.ByPath, sel.ByPath) {
+		return false
+	}
+	return pi.IsUSB()
+}
+
+func hasLink(links []string, name string) bool {
+	for _, l := range links {
+		if filepath.Base(l) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectorError is returned when a port selector does not match exactly one
+// port.
+type SelectorError struct {
+	Selector string
+	// Matches contains the matching ports, if there is more than one.
+	Matches []PortInfo
+}
+
+func (se *SelectorError) Error() string {
+	if len(se.Matches) == 0 {
+		return fmt.Sprintf("no serial port matches %q", se.Selector)
+	}
+
+	devices := make([]string, len(se.Matches))
+	for i := range se.Matches {
+		devices[i] = se.Matches[i].Device
+	}
+	return fmt.Sprintf("%d serial ports match %q: %s", len(se.Matches), se.Selector, strings.Join(devices, ", "))
+}
+
+// Resolve returns the device path of the one port matching the port
+// selector s. If no or several ports match, the error is a *SelectorError.
+func (pl PortLister) Resolve(s string) (string, error) {
+	sel, err := ParsePortSelector(s)
+	if err != nil {
+		return "", err
+	}
+
+	ports, err := pl.List()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []PortInfo
+	for i := range ports {
+		if sel.Matches(&ports[i]) {
+			matches = append(matches, ports[i])
+		}
+	}
+	if len(matches) != 1 {
+		return "", &SelectorError{Selector: s, Matches: matches}
+	}
+
+	return matches[0].Device, nil
+}
+
+// resolvePortName turns port selectors into device paths and returns all
+// other names unchanged.
+func resolvePortName(fn string) (string, error) {
+	if !IsPortSelector(fn) {
+		return fn, nil
+	}
+	return PortLister{}.Resolve(fn)
+}
@@ -0,0 +1,83 @@
+package sers
+
+import (
+	"testing"
+)
+
+func TestParsePortSelector(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		sel PortSelector
+	}{
+		{"usb:", PortSelector{Interface: -1}},
+		{"usb:0403", PortSelector{VID: 0x0403, Interface: -1}},
+		{"usb:0403:6001", PortSelector{VID: 0x0403, PID: 0x6001, Interface: -1}},
+		{"usb:0403:6001:serial=A12345", PortSelector{VID: 0x0403, PID: 0x6001, SerialNumber: "A12345", Interface: -1}},
+		{"usb:0403:6010:interface=1", PortSelector{VID: 0x0403, PID: 0x6010, Interface: 1}},
+		{"usb:serial=A12345:interface=0", PortSelector{SerialNumber: "A12345", Interface: 0}},
+		{"usb:2341:by-id=usb-Arduino_Uno-if00", PortSelector{VID: 0x2341, ByID: "usb-Arduino_Uno-if00", Interface: -1}},
+		{"usb:by-path=pci-0000:00:14.0-usb-0:2:1.0-port0", PortSelector{ByPath: "pci-0000:00:14.0-usb-0:2:1.0-port0", Interface: -1}},
+		{"usb:by-path=/dev/serial/by-path/pci-0000:00:14.0-usb-0:2:1.0-port0", PortSelector{ByPath: "pci-0000:00:14.0-usb-0:2:1.0-port0", Interface: -1}},
+	} {
+		sel, err := ParsePortSelector(tc.s)
+		if err != nil {
+			t.Errorf("ParsePortSelector(%q) returned error: %v", tc.s, err)
+			continue
+		}
+		if sel != tc.sel {
+			t.Errorf("ParsePortSelector(%q) = %+v, want %+v", tc.s, sel, tc.sel)
+		}
+	}
+
+	for _, s := range []string{
+		"/dev/ttyUSB0",
+		"usb:xyz",
+		"usb:0403:6001:6002",
+		"usb:serial=A12345:0403",
+		"usb:interface=x",
+		"usb:color=blue",
+	} {
+		if _, err := ParsePortSelector(s); err == nil {
+			t.Errorf("ParsePortSelector(%q) succeeded, expected error", s)
+		}
+	}
+}
+
+func TestPortSelectorMatches(t *testing.T) {
+	pi := PortInfo{
+		Device:       "/dev/ttyUSB0",
+		Bus:          "usb",
+		VID:          0x0403,
+		PID:          0x6001,
+		SerialNumber: "A12345",
+		Interface:    0,
+		ByPath:       []string{"/dev/serial/by-path/pci-0000:00:14.0-usb-0:2:1.0-port0"},
+	}
+
+	for _, tc := range []struct {
+		s     string
+		match bool
+	}{
+		{"usb:", true},
+		{"usb:0403:6001", true},
+		{"usb:0403:6001:serial=A12345:interface=0", true},
+		{"usb:by-path=pci-0000:00:14.0-usb-0:2:1.0-port0", true},
+		{"usb:0403:6010", false},
+		{"usb:serial=A1234", false},
+		{"usb:interface=1", false},
+		{"usb:by-id=usb-FTDI_A12345-port", false},
+	} {
+		sel, err := ParsePortSelector(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := sel.Matches(&pi); m != tc.match {
+			t.Errorf("%q matches %+v: %v, want %v", tc.s, pi, m, tc.match)
+		}
+	}
+
+	builtin := PortInfo{Device: "/dev/ttyS0", Bus: "pnp", Interface: -1}
+	if sel, _ := ParsePortSelector("usb:"); sel.Matches(&builtin) {
+		t.Errorf("usb selector matches non-USB port %+v", builtin)
+	}
+}
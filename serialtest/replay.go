@@ -0,0 +1,64 @@
+package serialtest
+
+import (
+	"time"
+
+	"github.com/distributed/sers/record"
+)
+
+// Matching selects how a replayer compares the writes of the code under test
+// with those of the recording.
+type Matching int
+
+const (
+	// Strict requires writes and SetMode calls to match the recording.
+	Strict Matching = iota
+
+	// Lenient only requires the code under test to write as many bytes as
+	// recorded, without comparing them, and accepts any SetMode calls.
+	// This suits protocols that carry timestamps or sequence numbers.
+	Lenient
+)
+
+// NewReplayer returns a MockPort that plays back a recording made with
+// record.Recorder. Recorded reads become replies, delivered with the same
+// delay after the preceding write as in the recording, and recorded read
+// timeouts make reads time out. Recorded writes become expected writes,
+// compared according to matching. In either case, the chunks in which data
+// is written do not matter.
+//
+// SetReadParams and SetBreak calls are accepted without comparing them with
+// the recording, as they are with any MockPort.
+func NewReplayer(t TB, events []record.Event, matching Matching) *MockPort {
+	mp := NewMockPort(t)
+	mp.anyMode = matching == Lenient
+
+	var lastWrite time.Duration
+	for _, ev := range events {
+		switch ev.Op {
+		case record.Write:
+			if len(ev.Data) == 0 {
+				continue
+			}
+			mp.add(&step{kind: stepWrite, data: ev.Data, anyData: matching == Lenient})
+			lastWrite = ev.Time
+		case record.Read:
+			if len(ev.Data) > 0 {
+				delay := ev.Time - lastWrite
+				if delay < 0 {
+					delay = 0
+				}
+				mp.add(&step{kind: stepReply, data: ev.Data, delay: delay})
+			}
+			if ev.TimedOut {
+				mp.add(&step{kind: stepTimeout})
+			}
+		case record.SetMode:
+			if matching == Strict && ev.Err == "" {
+				mp.add(&step{kind: stepSetMode, mode: ev.Mode})
+			}
+		}
+	}
+
+	return mp
+}
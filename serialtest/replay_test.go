@@ -0,0 +1,98 @@
+package serialtest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+	"github.com/distributed/sers/record"
+)
+
+// query is a tiny driver: it sends a command and reads the answer.
+func query(t *testing.T, sp sers.SerialPort, cmd string) (string, time.Duration) {
+	t.Helper()
+	start := time.Now()
+	if _, err := sp.Write([]byte(cmd)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := sp.Read(buf)
+	if err != nil {
+		if te, ok := err.(interface{ Timeout() bool }); ok && te.Timeout() {
+			return "timeout", time.Since(start)
+		}
+		t.Fatal(err)
+	}
+	return string(buf[:n]), time.Since(start)
+}
+
+func session(t *testing.T, sp sers.SerialPort, version string) []string {
+	t.Helper()
+	if err := sp.SetMode(9600, 8, sers.E, 1, sers.NO_HANDSHAKE); err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.SetReadParams(0, 0.2); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := query(t, sp, "ATI"+version+"\r")
+	b, _ := query(t, sp, "ATZ\r")
+	return []string{a, b}
+}
+
+func TestReplayer(t *testing.T) {
+	// record a session with a device that answers the first command only
+	device := NewMockPort(t)
+	device.ExpectSetMode("9600,8e1")
+	device.ExpectWrite([]byte("ATI1\r")).Reply([]byte("MODEM 1.0\r"), 30*time.Millisecond)
+	device.ExpectWrite([]byte("ATZ\r")).TimeoutRead()
+
+	var buf bytes.Buffer
+	rec := record.NewRecorder(device, record.NewWriter(&buf))
+	answers := session(t, rec, "1")
+	if answers[0] != "MODEM 1.0\r" || answers[1] != "timeout" {
+		t.Fatalf("recorded session got answers %q", answers)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+	device.Verify()
+
+	events, err := record.ReadAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// strict replay of the same session
+	rp := NewReplayer(t, events, Strict)
+	rp.SetMode(9600, 8, sers.E, 1, sers.NO_HANDSHAKE)
+	rp.SetReadParams(0, 0.2)
+	answer, d := query(t, rp, "ATI1\r")
+	if answer != "MODEM 1.0\r" {
+		t.Errorf("replay got answer %q", answer)
+	}
+	if d < 30*time.Millisecond {
+		t.Errorf("replayed answer arrived after %v, want 30ms", d)
+	}
+	if answer, _ := query(t, rp, "ATZ\r"); answer != "timeout" {
+		t.Errorf("replay got answer %q, want timeout", answer)
+	}
+	rp.Verify()
+
+	// strict replay catches the difference
+	rec2 := &recorder{}
+	rp = NewReplayer(rec2, events, Strict)
+	session(t, rp, "2")
+	rp.Verify()
+	rec2.check(t, `write "ATI2\r" does not match expected write "ATI1\r"`)
+
+	// lenient replay does not
+	rec3 := &recorder{}
+	rp = NewReplayer(rec3, events, Lenient)
+	rp.SetMode(115200, 8, sers.N, 1, sers.NO_HANDSHAKE)
+	if answers := session(t, rp, "2"); answers[0] != "MODEM 1.0\r" || answers[1] != "timeout" {
+		t.Errorf("lenient replay got answers %q", answers)
+	}
+	rp.Verify()
+	rec3.check(t)
+}
@@ -0,0 +1,484 @@
+// Package serialtest provides a scriptable sers.SerialPort for testing code
+// that talks to serial devices, without any hardware.
+//
+// A MockPort plays a script of steps in order. Some steps wait for the code
+// under test, such as an expected write or SetMode call, others take effect
+// as soon as they are reached, such as a reply or an injected break:
+//
+//	mp := serialtest.NewMockPort(t)
+//	mp.ExpectSetMode("9600,8e1")
+//	mp.ExpectWrite([]byte("ATI\r")).Reply([]byte("MODEM 1.0\r"), 20*time.Millisecond)
+//	mp.TimeoutRead()
+//
+//	err := runDriver(mp)
+//	...
+//	mp.Verify()
+//
+// Calls that do not match the script are reported through the TB, usually
+// the test's *testing.T.
+//
+// NewReplayer turns a recording made with package record into a script, so
+// that a session captured from a real device can serve as a regression
+// test.
+package serialtest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+// TB is the part of testing.TB used by MockPort for reporting mismatches.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+type stepKind int
+
+const (
+	stepWrite stepKind = iota
+	stepSetMode
+	stepReply
+	stepBreak
+	stepTimeout
+)
+
+type step struct {
+	kind    stepKind
+	data    []byte
+	anyData bool // only the length of a write matters
+	matched int
+	mode    sers.Mode
+	delay   time.Duration
+}
+
+func (s *step) String() string {
+	switch s.kind {
+	case stepWrite:
+		if s.anyData {
+			return fmt.Sprintf("write of %d bytes", len(s.data))
+		}
+		return fmt.Sprintf("write %q", s.data)
+	case stepSetMode:
+		return fmt.Sprintf("SetMode %v", s.mode)
+	case stepReply:
+		return fmt.Sprintf("reply %q after %v", s.data, s.delay)
+	case stepBreak:
+		return "break"
+	case stepTimeout:
+		return "read timeout"
+	}
+	return "invalid step"
+}
+
+// chunk is received data that becomes readable at a certain time. Chunks
+// marked as timeout carry no data, but make a Read time out instead.
+type chunk struct {
+	at      time.Time
+	data    []byte
+	brk     bool
+	timeout bool
+}
+
+// MockPort is a sers.SerialPort that follows a script. It also implements
+// sers.LineStatsReader, counting the bytes read and written as well as the
+// injected breaks that have been read.
+//
+// Reads behave like those of a real port, as configured through
+// SetReadParams: a Read blocks until data has been received or the read
+// timeout expires. Timeouts are reported as errors with a Timeout method
+// returning true. Without a read timeout, a Read waiting for a reply that is
+// not in the script blocks until the port is closed.
+type MockPort struct {
+	t TB
+
+	lock    sync.Mutex
+	steps   []*step
+	rx      []chunk
+	changed chan struct{}
+	closed  bool
+
+	// anyMode accepts SetMode calls that are not in the script.
+	anyMode bool
+
+	mode    sers.Mode
+	minread int
+	rtime   time.Duration
+	brk     bool
+	stats   sers.LineStats
+}
+
+var (
+	_ sers.SerialPort      = (*MockPort)(nil)
+	_ sers.LineStatsReader = (*MockPort)(nil)
+)
+
+// NewMockPort returns a MockPort with an empty script, reporting mismatches
+// to t. Its mode is initially 9600,8n1 and reads block until at least one
+// byte has been received, as with a freshly opened port.
+func NewMockPort(t TB) *MockPort {
+	return &MockPort{
+		t:       t,
+		mode:    sers.Mode{Baudrate: 9600, DataBits: 8, Parity: sers.N, Stopbits: 1, Handshake: sers.NO_HANDSHAKE},
+		minread: 1,
+	}
+}
+
+func (mp *MockPort) add(s *step) *MockPort {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.steps = append(mp.steps, s)
+	mp.advance()
+	return mp
+}
+
+// ExpectWrite expects the code under test to write data. The data may be
+// split across several calls to Write.
+func (mp *MockPort) ExpectWrite(data []byte) *MockPort {
+	return mp.add(&step{kind: stepWrite, data: data})
+}
+
+// ExpectSetMode expects a call to SetMode with the mode given as a
+// modestring, e.g. "9600,8e1". See sers.ParseModestring for the format.
+func (mp *MockPort) ExpectSetMode(modestring string) *MockPort {
+	mode, err := sers.ParseModestring(modestring)
+	if err != nil {
+		mp.t.Helper()
+		mp.t.Errorf("serialtest: ExpectSetMode: %v", err)
+		return mp
+	}
+	return mp.add(&step{kind: stepSetMode, mode: mode})
+}
+
+// Reply makes data readable after delay has passed since the previous step
+// has been completed. Replies become readable in the order of the script.
+func (mp *MockPort) Reply(data []byte, delay time.Duration) *MockPort {
+	return mp.add(&step{kind: stepReply, data: data, delay: delay})
+}
+
+// InjectBreak makes the port receive a break condition. Like a port in raw
+// mode on Linux does, the break is read as a single NUL byte. It is also
+// counted in the Break field of LineStats once read.
+func (mp *MockPort) InjectBreak() *MockPort {
+	return mp.add(&step{kind: stepBreak})
+}
+
+// TimeoutRead makes a Read time out once the data of the preceding replies
+// has been read, no matter whether more data is available.
+func (mp *MockPort) TimeoutRead() *MockPort {
+	return mp.add(&step{kind: stepTimeout})
+}
+
+// Verify reports the steps of the script that have not been reached.
+func (mp *MockPort) Verify() {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.t.Helper()
+	for _, s := range mp.steps {
+		mp.t.Errorf("serialtest: expected %s, which did not happen", s)
+	}
+}
+
+// advance carries out the steps at the head of the script that do not wait
+// for the code under test. It has to be called with the lock held.
+func (mp *MockPort) advance() {
+	for len(mp.steps) > 0 {
+		s := mp.steps[0]
+		switch s.kind {
+		case stepReply:
+			mp.receive(chunk{at: time.Now().Add(s.delay), data: s.data})
+		case stepBreak:
+			mp.receive(chunk{at: time.Now(), data: []byte{0}, brk: true})
+		case stepTimeout:
+			mp.receive(chunk{at: time.Now(), timeout: true})
+		default:
+			return
+		}
+		mp.steps = mp.steps[1:]
+	}
+}
+
+// receive queues c, keeping the order of the script.
+func (mp *MockPort) receive(c chunk) {
+	if n := len(mp.rx); n > 0 && c.at.Before(mp.rx[n-1].at) {
+		c.at = mp.rx[n-1].at
+	}
+	mp.rx = append(mp.rx, c)
+	mp.signal()
+}
+
+// signal wakes up a blocked Read.
+func (mp *MockPort) signal() {
+	if mp.changed != nil {
+		close(mp.changed)
+		mp.changed = nil
+	}
+}
+
+// pop removes the step at the head of the script and carries out the
+// following ones that do not wait.
+func (mp *MockPort) pop() {
+	mp.steps = mp.steps[1:]
+	mp.advance()
+}
+
+// unexpected reports a call that does not match the head of the script.
+func (mp *MockPort) unexpected(call string) {
+	mp.t.Helper()
+	if len(mp.steps) == 0 {
+		mp.t.Errorf("serialtest: unexpected %s at the end of the script", call)
+		return
+	}
+	mp.t.Errorf("serialtest: unexpected %s, expected %s", call, mp.steps[0])
+}
+
+func (mp *MockPort) Write(b []byte) (int, error) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	if mp.closed {
+		return 0, sers.StringError("port closed")
+	}
+	mp.stats.Tx += uint32(len(b))
+
+	p := b
+	for len(p) > 0 {
+		if len(mp.steps) == 0 || mp.steps[0].kind != stepWrite {
+			mp.t.Helper()
+			mp.unexpected(fmt.Sprintf("write %q", p))
+			break
+		}
+
+		s := mp.steps[0]
+		rest := s.data[s.matched:]
+		n := len(p)
+		if n > len(rest) {
+			n = len(rest)
+		}
+		if !s.anyData && !bytes.Equal(p[:n], rest[:n]) {
+			mp.t.Helper()
+			mp.t.Errorf("serialtest: write %q does not match expected %s after %d matching bytes",
+				p, s, s.matched)
+			mp.pop()
+			break
+		}
+
+		s.matched += n
+		p = p[n:]
+		if s.matched == len(s.data) {
+			mp.pop()
+		}
+	}
+
+	return len(b), nil
+}
+
+func (mp *MockPort) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mode := sers.Mode{
+		Baudrate:  baudrate,
+		DataBits:  databits,
+		Parity:    parity,
+		Stopbits:  stopbits,
+		Handshake: handshake,
+	}
+	if !mode.Valid() {
+		return &sers.ParameterError{Parameter: "mode", Reason: fmt.Sprintf("%v is not valid", mode)}
+	}
+	mp.mode = mode
+
+	if mp.anyMode {
+		return nil
+	}
+	if len(mp.steps) == 0 || mp.steps[0].kind != stepSetMode {
+		mp.t.Helper()
+		mp.unexpected(fmt.Sprintf("SetMode %v", mode))
+		return nil
+	}
+	if s := mp.steps[0]; s.mode != mode {
+		mp.t.Helper()
+		mp.t.Errorf("serialtest: SetMode %v does not match expected %s", mode, s)
+	}
+	mp.pop()
+
+	return nil
+}
+
+func (mp *MockPort) GetMode() (sers.Mode, error) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	return mp.mode, nil
+}
+
+func (mp *MockPort) SetReadParams(minread int, timeout float64) error {
+	if timeout < 0 {
+		return &sers.ParameterError{Parameter: "timeout", Reason: "needs to be 0 or higher"}
+	}
+
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.minread = minread
+	mp.rtime = time.Duration(timeout * float64(time.Second))
+	return nil
+}
+
+func (mp *MockPort) SetBreak(on bool) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	mp.brk = on
+	return nil
+}
+
+// Break reports whether the code under test has turned on the generation of
+// a break condition.
+func (mp *MockPort) Break() bool {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	return mp.brk
+}
+
+func (mp *MockPort) LineStats() (sers.LineStats, error) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	stats := mp.stats
+	stats.Time = time.Now()
+	return stats, nil
+}
+
+// Close closes the port, blocked reads return an error.
+func (mp *MockPort) Close() error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	if mp.closed {
+		return sers.StringError("port closed")
+	}
+	mp.closed = true
+	mp.signal()
+	return nil
+}
+
+// take copies received data that is readable at now to b. It stops at a
+// timeout.
+func (mp *MockPort) take(b []byte, now time.Time) int {
+	n := 0
+	for len(mp.rx) > 0 && n < len(b) && !mp.rx[0].at.After(now) && !mp.rx[0].timeout {
+		c := &mp.rx[0]
+		m := copy(b[n:], c.data)
+		n += m
+		c.data = c.data[m:]
+		if len(c.data) == 0 {
+			if c.brk {
+				mp.stats.Break++
+			}
+			mp.rx = mp.rx[1:]
+		}
+	}
+	mp.stats.Rx += uint32(n)
+	return n
+}
+
+func (mp *MockPort) Read(b []byte) (int, error) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	want := mp.minread
+	if want < 1 {
+		want = 1
+	}
+	if want > len(b) {
+		want = len(b)
+	}
+
+	var deadline time.Time
+	if mp.rtime > 0 {
+		deadline = time.Now().Add(mp.rtime)
+	}
+
+	n := 0
+	for {
+		if mp.closed {
+			return n, sers.StringError("port closed")
+		}
+
+		now := time.Now()
+		n += mp.take(b[n:], now)
+		if n >= want {
+			return n, nil
+		}
+
+		if len(mp.rx) > 0 && mp.rx[0].timeout && !mp.rx[0].at.After(now) {
+			if n > 0 {
+				// the next Read will time out
+				return n, nil
+			}
+			mp.rx = mp.rx[1:]
+			return 0, timeoutError{}
+		}
+
+		// minread 0 without timeout polls
+		expired := mp.minread == 0 && mp.rtime == 0
+		if !deadline.IsZero() && !now.Before(deadline) {
+			expired = true
+		}
+		if expired {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, timeoutError{}
+		}
+
+		wake := deadline
+		if len(mp.rx) > 0 && (wake.IsZero() || mp.rx[0].at.Before(wake)) {
+			wake = mp.rx[0].at
+		}
+		if mp.changed == nil {
+			mp.changed = make(chan struct{})
+		}
+		changed := mp.changed
+
+		mp.lock.Unlock()
+		mp.wait(changed, wake)
+		mp.lock.Lock()
+	}
+}
+
+// wait blocks until changed is closed or wake has been reached, if it is
+// not zero.
+func (mp *MockPort) wait(changed <-chan struct{}, wake time.Time) {
+	if wake.IsZero() {
+		<-changed
+		return
+	}
+
+	t := time.NewTimer(time.Until(wake))
+	defer t.Stop()
+	select {
+	case <-changed:
+	case <-t.C:
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string {
+	return "timeout"
+}
+
+func (timeoutError) Timeout() bool {
+	return true
+}
@@ -0,0 +1,166 @@
+package serialtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+// recorder is a TB that records the reported errors.
+type recorder struct {
+	lock   sync.Mutex
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) check(t *testing.T, substrings ...string) {
+	t.Helper()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.errors) != len(substrings) {
+		t.Fatalf("got errors %q, want %d errors", r.errors, len(substrings))
+	}
+	for i, sub := range substrings {
+		if !strings.Contains(r.errors[i], sub) {
+			t.Errorf("error %q does not contain %q", r.errors[i], sub)
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	te, ok := err.(interface{ Timeout() bool })
+	return ok && te.Timeout()
+}
+
+func TestMockPortScript(t *testing.T) {
+	rec := &recorder{}
+	mp := NewMockPort(rec)
+	mp.ExpectSetMode("9600,8e1")
+	mp.ExpectWrite([]byte("ATI\r")).Reply([]byte("MODEM 1.0\r"), 20*time.Millisecond)
+	mp.TimeoutRead()
+	mp.ExpectWrite([]byte("ATZ\r")).InjectBreak().Reply([]byte("OK"), 0)
+
+	if err := mp.SetMode(9600, 8, sers.E, 1, sers.NO_HANDSHAKE); err != nil {
+		t.Fatal(err)
+	}
+	if mode, _ := mp.GetMode(); mode.String() != "9600,8e1,none" {
+		t.Errorf("GetMode returned %v", mode)
+	}
+
+	start := time.Now()
+	mp.Write([]byte("AT"))
+	mp.Write([]byte("I\r"))
+
+	buf := make([]byte, 32)
+	n, err := mp.Read(buf)
+	if err != nil || string(buf[:n]) != "MODEM 1.0\r" {
+		t.Errorf("Read returned %q, %v", buf[:n], err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("reply arrived after %v, want 20ms", d)
+	}
+
+	if n, err := mp.Read(buf); n != 0 || !isTimeout(err) {
+		t.Errorf("Read returned %d, %v, want timeout", n, err)
+	}
+
+	mp.Write([]byte("ATZ\r"))
+	if err := mp.SetReadParams(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err = mp.Read(buf)
+	if err != nil || string(buf[:n]) != "\x00OK" {
+		t.Errorf("Read returned %q, %v", buf[:n], err)
+	}
+
+	stats, err := mp.LineStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rx != 13 || stats.Tx != 8 || stats.Break != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	mp.Verify()
+	rec.check(t)
+}
+
+func TestMockPortMismatch(t *testing.T) {
+	rec := &recorder{}
+	mp := NewMockPort(rec)
+	mp.ExpectWrite([]byte("hello"))
+	mp.ExpectSetMode("19200")
+	mp.ExpectWrite([]byte("bye"))
+
+	mp.Write([]byte("help"))
+	mp.SetMode(9600, 8, sers.N, 1, sers.NO_HANDSHAKE)
+	mp.Verify()
+
+	rec.check(t,
+		`write "help" does not match expected write "hello" after 0 matching bytes`,
+		`SetMode 9600,8n1,none does not match expected SetMode 19200,8n1,none`,
+		`expected write "bye"`,
+	)
+
+	rec = &recorder{}
+	mp = NewMockPort(rec)
+	mp.ExpectWrite([]byte("x"))
+	mp.SetBreak(true)
+	mp.SetMode(9600, 8, sers.N, 1, sers.NO_HANDSHAKE)
+	mp.Write([]byte("xy"))
+	if !mp.Break() {
+		t.Error("break not recorded")
+	}
+	rec.check(t,
+		`unexpected SetMode 9600,8n1,none, expected write "x"`,
+		`unexpected write "y" at the end of the script`,
+	)
+}
+
+func TestMockPortReadParams(t *testing.T) {
+	rec := &recorder{}
+	mp := NewMockPort(rec)
+	buf := make([]byte, 8)
+
+	// polling
+	if err := mp.SetReadParams(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := mp.Read(buf); n != 0 || !isTimeout(err) {
+		t.Errorf("Read returned %d, %v, want timeout", n, err)
+	}
+
+	if err := mp.SetReadParams(0, 0.05); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if n, err := mp.Read(buf); n != 0 || !isTimeout(err) {
+		t.Errorf("Read returned %d, %v, want timeout", n, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond || d > time.Second {
+		t.Errorf("Read timed out after %v, want 50ms", d)
+	}
+
+	// blocking read ended by Close
+	if err := mp.SetReadParams(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(20*time.Millisecond, func() { mp.Close() })
+	if _, err := mp.Read(buf); err == nil {
+		t.Error("Read on closed port succeeded")
+	}
+
+	rec.check(t)
+}
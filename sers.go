@@ -8,6 +8,7 @@
 package sers
 
 import (
+	"context"
 	"fmt"
 	"io"
 )
@@ -16,11 +17,15 @@ const (
 	N = 0 // no parity
 	E = 1 // even parity
 	O = 2 // odd parity
+	M = 3 // mark parity, parity bit always 1
+	S = 4 // space parity, parity bit always 0
 )
 
 const (
-	NO_HANDSHAKE     = 0
-	RTSCTS_HANDSHAKE = 1
+	NO_HANDSHAKE      = 0
+	RTSCTS_HANDSHAKE  = 1
+	XONXOFF_HANDSHAKE = 2 // software flow control
+	RS485_HANDSHAKE   = 3 // driver-controlled RS-485 transceiver, see RS485
 )
 
 // Serialport represents a serial port and offers configuration of baud
@@ -34,9 +39,9 @@ type SerialPort interface {
 	// SetMode sets the frame format and handshaking configuration.
 	// baudrate may be freely chosen, the driver is allowed to reject
 	// unachievable baud rates. databits may be any number of data bits
-	// supported by the driver. parity is one of (N|O|E) for none, odd
-	// or even parity. handshake is either NO_HANDSHAKE or
-	// RTSCTS_HANDSHAKE.
+	// supported by the driver. parity is one of (N|O|E|M|S) for none, odd,
+	// even, mark or space parity. handshake is one of NO_HANDSHAKE, RTSCTS_HANDSHAKE
+	// or XONXOFF_HANDSHAKE.
 	//
 	// Known bug on Windows: Only NO_HANDSHAKE is supported.
 	SetMode(baudrate, databits, parity, stopbits, handshake int) error
@@ -57,6 +62,35 @@ type SerialPort interface {
 	SetBreak(on bool) error
 }
 
+// Flusher is implemented by serial ports that can discard buffered data and
+// wait for written data to be transmitted. The serial ports returned by Open
+// implement it.
+type Flusher interface {
+	// FlushInput discards data that has been received but not read yet.
+	FlushInput() error
+
+	// FlushOutput discards data that has been written but not
+	// transmitted yet.
+	FlushOutput() error
+
+	// Drain blocks until all data written to the port has been
+	// transmitted. Under flow control, this may take forever. If ctx is
+	// done before, Drain discards the pending output, as FlushOutput does,
+	// and returns ctx.Err().
+	Drain(ctx context.Context) error
+}
+
+// QueueStatus is implemented by serial ports that can report how much data
+// is buffered by the driver. The serial ports returned by Open implement it.
+type QueueStatus interface {
+	// InputWaiting returns the number of bytes received but not read yet.
+	InputWaiting() (int, error)
+
+	// OutputWaiting returns the number of bytes written but not
+	// transmitted yet.
+	OutputWaiting() (int, error)
+}
+
 func SetModeStruct(sp SerialPort, mode Mode) error {
 	return sp.SetMode(mode.Baudrate, mode.DataBits, mode.Parity, mode.Stopbits, mode.Handshake)
 
@@ -77,21 +111,45 @@ func (m Mode) Valid() bool {
 	if m.DataBits < 5 || m.DataBits > 8 {
 		return false
 	}
-	if !(m.Parity == N || m.Parity == O || m.Parity == E) {
+	if !(m.Parity == N || m.Parity == O || m.Parity == E || m.Parity == M || m.Parity == S) {
 		return false
 	}
 	if !(m.Stopbits == 1 || m.Stopbits == 2) {
 		return false
 	}
-	if !(m.Handshake == NO_HANDSHAKE || m.Handshake == RTSCTS_HANDSHAKE) {
+	switch m.Handshake {
+	case NO_HANDSHAKE, RTSCTS_HANDSHAKE, XONXOFF_HANDSHAKE, RS485_HANDSHAKE:
+	default:
 		return false
 	}
 
 	return true
 }
 
+// check returns a ParameterError for the first invalid setting in m. Unlike
+// Valid, it rejects a baud rate of 0.
+func (m Mode) check() error {
+	switch {
+	case m.Baudrate <= 0:
+		return &ParameterError{"baudrate", "has to be > 0"}
+	case m.DataBits < 5 || m.DataBits > 8:
+		return &ParameterError{"databits", "has to be 5, 6, 7 or 8"}
+	case m.Stopbits != 1 && m.Stopbits != 2:
+		return &ParameterError{"stopbits", "has to be 1 or 2"}
+	case !(m.Parity == N || m.Parity == O || m.Parity == E || m.Parity == M || m.Parity == S):
+		return &ParameterError{"parity", "has to be N, E, O, M or S"}
+	case !m.Valid():
+		return &ParameterError{"handshake", "has to be NO_HANDSHAKE, RTSCTS_HANDSHAKE, XONXOFF_HANDSHAKE or RS485_HANDSHAKE"}
+	}
+	return nil
+}
+
+// String returns the modestring of m, as FormatModestring does, e.g.
+// "115200,8n1,none". Invalid modes are shown as "invalid_mode(...)" with the
+// values of the fields.
 func (m Mode) String() string {
-	if !m.Valid() {
+	s, err := FormatModestring(m)
+	if err != nil {
 		return fmt.Sprintf("invalid_mode(%d,%d,%d,%d,%d)",
 			m.Baudrate,
 			m.DataBits,
@@ -99,39 +157,13 @@ func (m Mode) String() string {
 			m.Stopbits,
 			m.Handshake)
 	}
-
-	parstring := ""
-	switch m.Parity {
-	case N:
-		parstring = "n"
-	case O:
-		parstring = "o"
-	case E:
-		parstring = "e"
-	default:
-		panic("unhandled parity setting")
-	}
-
-	hsstring := ""
-	switch m.Handshake {
-	case NO_HANDSHAKE:
-		hsstring = "none"
-	case RTSCTS_HANDSHAKE:
-		hsstring = "rtscts"
-	default:
-		panic("unhandled handshake setting")
-	}
-
-	return fmt.Sprintf("%d,%d%s%d,%s",
-		m.Baudrate,
-		m.DataBits,
-		parstring,
-		m.Stopbits,
-		hsstring)
+	return s
 }
 
 type StringError string
 
+var errPortClosed error = StringError("port closed")
+
 func (se StringError) Error() string {
 	return string(se)
 }
@@ -7,6 +7,7 @@ package sers
 // license that can be found in the LICENSE file.
 
 /*#include <sys/ioctl.h>
+#include <termios.h>
 #include <IOKit/serial/ioss.h>
 
 #include <sys/types.h>
@@ -20,6 +21,7 @@ import "C"
 
 import (
 	"sync"
+	"syscall"
 	"unsafe"
 )
 
@@ -30,6 +32,118 @@ const (
 	IOSSIOSPEED = 0x80045402
 )
 
+type tcflag = uint64
+
+type termios syscall.Termios
+
+const (
+	tcVMIN  = syscall.VMIN
+	tcVTIME = syscall.VTIME
+
+	tcIGNBRK = syscall.IGNBRK
+	tcBRKINT = syscall.BRKINT
+	tcPARMRK = syscall.PARMRK
+	tcISTRIP = syscall.ISTRIP
+	tcINLCR  = syscall.INLCR
+	tcIGNCR  = syscall.IGNCR
+	tcICRNL  = syscall.ICRNL
+	tcIXON   = syscall.IXON
+	tcIXOFF  = syscall.IXOFF
+	tcIXANY  = syscall.IXANY
+
+	tcOPOST = syscall.OPOST
+
+	tcCSIZE   = syscall.CSIZE
+	tcCS5     = syscall.CS5
+	tcCS6     = syscall.CS6
+	tcCS7     = syscall.CS7
+	tcCS8     = syscall.CS8
+	tcCSTOPB  = syscall.CSTOPB
+	tcPARENB  = syscall.PARENB
+	tcPARODD  = syscall.PARODD
+	tcCRTSCTS = C.CRTSCTS
+	tcCMSPAR  = 0 // not supported
+
+	tcISIG   = syscall.ISIG
+	tcICANON = syscall.ICANON
+	tcECHO   = syscall.ECHO
+	tcECHONL = syscall.ECHONL
+	tcIEXTEN = syscall.IEXTEN
+)
+
+func (bp *baseport) ioctl(req uint, arg unsafe.Pointer) error {
+	ret, err := C.ioctl1(C.int(bp.fd), C.uint(req), arg)
+	if ret == -1 {
+		return err
+	}
+
+	return nil
+}
+
+func (bp *baseport) getattr() (*termios, error) {
+	var tio termios
+	if err := bp.ioctl(syscall.TIOCGETA, unsafe.Pointer(&tio)); err != nil {
+		return nil, err
+	}
+
+	return &tio, nil
+}
+
+func (bp *baseport) setattr(tio *termios) error {
+	return bp.ioctl(syscall.TIOCSETA, unsafe.Pointer(tio))
+}
+
+func (bp *baseport) flush(input, output bool) error {
+	// FREAD and FWRITE from sys/fcntl.h
+	const (
+		fREAD  = 0x1
+		fWRITE = 0x2
+	)
+
+	var queue int32
+	if input {
+		queue |= fREAD
+	}
+	if output {
+		queue |= fWRITE
+	}
+
+	return bp.ioctl(syscall.TIOCFLUSH, unsafe.Pointer(&queue))
+}
+
+// drain blocks until all output has been transmitted, like tcdrain(3).
+func (bp *baseport) drain() error {
+	return bp.ioctl(syscall.TIOCDRAIN, nil)
+}
+
+// queued returns the number of bytes in the input or output queue.
+func (bp *baseport) queued(input bool) (int, error) {
+	// FIONREAD from sys/filio.h, which the syscall package lacks
+	const fIONREAD = 0x4004667f
+
+	var req uint = syscall.TIOCOUTQ
+	if input {
+		req = fIONREAD
+	}
+
+	var n int32
+	if err := bp.ioctl(req, unsafe.Pointer(&n)); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (bp *baseport) setRS485Mode(on bool) (bool, error) {
+	if on {
+		return false, &ParameterError{"handshake", "RS485_HANDSHAKE is not supported on this platform"}
+	}
+	return false, nil
+}
+
+func (bp *baseport) rs485Enabled() bool {
+	return false
+}
+
 type termiosPlatformData struct {
 	lock        sync.Mutex
 	baudrateSet bool
@@ -42,8 +156,8 @@ func (bp *baseport) SetBaudRate(br int) error {
 	//fmt.Printf("C.IOSSIOSPEED %x\n", uint64(C.IOSSIOSPEED))
 	//fmt.Printf("for file %v, fd %d\n", bp.f, bp.fd)
 
-	ret, err := C.ioctl1(C.int(bp.fd), C.uint(IOSSIOSPEED), unsafe.Pointer(&speed))
-	if ret == -1 || err != nil {
+	err := bp.ioctl(IOSSIOSPEED, unsafe.Pointer(&speed))
+	if err != nil {
 		return &Error{"setting baud rate: ioctl", err}
 	}
 
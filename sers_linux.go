@@ -7,36 +7,154 @@ package sers
 // license that can be found in the LICENSE file.
 
 /*
-#include <termios.h>
 
- extern int setbaudrate(int fd, int br);
- extern int clearnonblocking(int fd);
- extern int getbaudrate(int fd, int *br);
+So... custom baud rate support is a very sad topic under linux. The C library
+headers disagree with the kernel about the layout of struct termios, and
+struct termios2, which carries arbitrary baud rates, is not exposed by the C
+library at all.
+
+The picocom has a whole rant/article about the situation:
+https://github.com/Rosonix/picocom/blob/master/termios2.txt
+
+We stay clear of the C library and talk to the kernel through ioctls only.
+The kernel's view of struct termios2 and the values of the flags differ
+between architectures, so these live in sers_linux_{generic,mipsx,ppc64x}.go,
+copied from the respective termbits.h and ioctls.h of the kernel sources.
+
 */
-import "C"
-import "fmt"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
 
 type termiosPlatformData struct{}
 
+func (bp *baseport) ioctl(req uint, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(bp.fd), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// ioctlValue is used for ioctls that take an integer value rather than a
+// pointer as argument.
+func (bp *baseport) ioctlValue(req uint, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(bp.fd), uintptr(req), arg)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func (bp *baseport) getattr() (*termios, error) {
+	var tio termios
+	if err := bp.ioctl(ioctlGetTermios, unsafe.Pointer(&tio)); err != nil {
+		return nil, err
+	}
+
+	return &tio, nil
+}
+
+func (bp *baseport) setattr(tio *termios) error {
+	return bp.ioctl(ioctlSetTermios, unsafe.Pointer(tio))
+}
+
+func (bp *baseport) flush(input, output bool) error {
+	var queue uintptr
+	switch {
+	case input && output:
+		queue = syscall.TCIOFLUSH
+	case input:
+		queue = syscall.TCIFLUSH
+	case output:
+		queue = syscall.TCOFLUSH
+	}
+
+	return bp.ioctlValue(ioctlTCFLSH, queue)
+}
+
+// drain blocks until all output has been transmitted, like tcdrain(3).
+func (bp *baseport) drain() error {
+	// a non-zero argument makes TCSBRK wait for the output to drain
+	// without sending a break.
+	return bp.ioctlValue(ioctlTCSBRK, 1)
+}
+
+// queued returns the number of bytes in the input or output queue.
+func (bp *baseport) queued(input bool) (int, error) {
+	var req uint = syscall.TIOCOUTQ
+	if input {
+		req = syscall.TIOCINQ
+	}
+
+	var n int32
+	if err := bp.ioctl(req, unsafe.Pointer(&n)); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
 func (bp *baseport) SetBaudRate(br int) error {
-	// setting baud rate via new struct termios2 method
-	_, err := C.setbaudrate(C.int(bp.fd), C.int(br))
+	tio, err := bp.getattr()
 	if err != nil {
-		return err
+		return &Error{"getattr", err}
+	}
+
+	// we prefer the traditional baud rate constants over BOTHER. drivers
+	// should not care, but the constants have been around for longer and
+	// thus have seen more testing.
+	speed, ok := baudrateConstant(br)
+	if !ok {
+		speed = tcBOTHER
+	}
+
+	tio.Cflag &^= tcCBAUD | tcCIBAUD
+	tio.Cflag |= speed
+	tio.Ispeed = uint32(br)
+	tio.Ospeed = uint32(br)
+
+	if err := bp.setattr(tio); err != nil {
+		return &Error{"setting baud rate", err}
 	}
 
 	return nil
 }
 
 func (bp *baseport) getBaudrate() (int, error) {
-	var br C.int
-	ret, errnoerr := C.getbaudrate(C.int(bp.fd), &br)
-	if errnoerr != nil {
-		return 0, fmt.Errorf("error getting baud rate: %v", errnoerr)
+	tio, err := bp.getattr()
+	if err != nil {
+		return 0, fmt.Errorf("error getting baud rate: %v", err)
 	}
-	if ret != 0 {
-		return 0, fmt.Errorf("error getting baud rate")
+
+	speed := tio.Cflag & tcCBAUD
+	if speed != tcBOTHER {
+		if br, ok := constantBaudrate(speed); ok {
+			return br, nil
+		}
 	}
 
-	return int(br), nil
+	return int(tio.Ospeed), nil
+}
+
+func baudrateConstant(br int) (tcflag, bool) {
+	for _, b := range baudrates {
+		if b.baudrate == br {
+			return b.speed, true
+		}
+	}
+	return 0, false
+}
+
+func constantBaudrate(speed tcflag) (int, bool) {
+	for _, b := range baudrates {
+		if b.speed == speed {
+			return b.baudrate, true
+		}
+	}
+	return 0, false
 }
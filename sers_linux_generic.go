@@ -0,0 +1,109 @@
+// +build linux
+// +build 386 amd64 arm arm64 loong64 riscv64 s390x
+
+package sers
+
+// Copyright 2012 Michael Meier. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Definitions from include/uapi/asm-generic/termbits.h and ioctls.h, which
+// are shared by most architectures.
+
+type tcflag = uint32
+
+// termios is the kernel's struct termios2.
+type termios struct {
+	Iflag  tcflag
+	Oflag  tcflag
+	Cflag  tcflag
+	Lflag  tcflag
+	Line   uint8
+	Cc     [19]uint8
+	Ispeed uint32
+	Ospeed uint32
+}
+
+const (
+	ioctlGetTermios = 0x802c542a // TCGETS2
+	ioctlSetTermios = 0x402c542b // TCSETS2
+	ioctlTCSBRK     = 0x5409
+	ioctlTCFLSH     = 0x540b
+	ioctlTIOCGRS485 = 0x542e
+	ioctlTIOCSRS485 = 0x542f
+)
+
+const (
+	tcVTIME = 5
+	tcVMIN  = 6
+
+	tcIGNBRK = 0x1
+	tcBRKINT = 0x2
+	tcPARMRK = 0x8
+	tcISTRIP = 0x20
+	tcINLCR  = 0x40
+	tcIGNCR  = 0x80
+	tcICRNL  = 0x100
+	tcIXON   = 0x400
+	tcIXANY  = 0x800
+	tcIXOFF  = 0x1000
+
+	tcOPOST = 0x1
+
+	tcCBAUD   = 0x100f
+	tcCSIZE   = 0x30
+	tcCS5     = 0x0
+	tcCS6     = 0x10
+	tcCS7     = 0x20
+	tcCS8     = 0x30
+	tcCSTOPB  = 0x40
+	tcPARENB  = 0x100
+	tcPARODD  = 0x200
+	tcBOTHER  = 0x1000
+	tcCIBAUD  = 0x100f0000
+	tcCMSPAR  = 0x40000000
+	tcCRTSCTS = 0x80000000
+
+	tcISIG   = 0x1
+	tcICANON = 0x2
+	tcECHO   = 0x8
+	tcECHONL = 0x40
+	tcIEXTEN = 0x8000
+)
+
+var baudrates = []struct {
+	baudrate int
+	speed    tcflag
+}{
+	{0, 0x0},
+	{50, 0x1},
+	{75, 0x2},
+	{110, 0x3},
+	{134, 0x4},
+	{150, 0x5},
+	{200, 0x6},
+	{300, 0x7},
+	{600, 0x8},
+	{1200, 0x9},
+	{1800, 0xa},
+	{2400, 0xb},
+	{4800, 0xc},
+	{9600, 0xd},
+	{19200, 0xe},
+	{38400, 0xf},
+	{57600, 0x1001},
+	{115200, 0x1002},
+	{230400, 0x1003},
+	{460800, 0x1004},
+	{500000, 0x1005},
+	{576000, 0x1006},
+	{921600, 0x1007},
+	{1000000, 0x1008},
+	{1152000, 0x1009},
+	{1500000, 0x100a},
+	{2000000, 0x100b},
+	{2500000, 0x100c},
+	{3000000, 0x100d},
+	{3500000, 0x100e},
+	{4000000, 0x100f},
+}
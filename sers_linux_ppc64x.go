@@ -0,0 +1,110 @@
+// +build linux
+// +build ppc64 ppc64le
+
+package sers
+
+// Copyright 2012 Michael Meier. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Definitions from arch/powerpc/include/uapi/asm/termbits.h and ioctls.h.
+
+type tcflag = uint32
+
+// termios is the kernel's struct termios. There is no struct termios2 on
+// powerpc as struct termios carries the baud rates already. Note that c_line
+// comes after c_cc.
+type termios struct {
+	Iflag  tcflag
+	Oflag  tcflag
+	Cflag  tcflag
+	Lflag  tcflag
+	Cc     [19]uint8
+	Line   uint8
+	Ispeed uint32
+	Ospeed uint32
+}
+
+const (
+	ioctlGetTermios = 0x402c7413 // TCGETS
+	ioctlSetTermios = 0x802c7414 // TCSETS
+	ioctlTCSBRK     = 0x2000741d
+	ioctlTCFLSH     = 0x2000741f
+	ioctlTIOCGRS485 = 0x542e
+	ioctlTIOCSRS485 = 0x542f
+)
+
+const (
+	tcVMIN  = 5
+	tcVTIME = 7
+
+	tcIGNBRK = 0x1
+	tcBRKINT = 0x2
+	tcPARMRK = 0x8
+	tcISTRIP = 0x20
+	tcINLCR  = 0x40
+	tcIGNCR  = 0x80
+	tcICRNL  = 0x100
+	tcIXON   = 0x200
+	tcIXOFF  = 0x400
+	tcIXANY  = 0x800
+
+	tcOPOST = 0x1
+
+	tcCBAUD   = 0xff
+	tcCSIZE   = 0x300
+	tcCS5     = 0x0
+	tcCS6     = 0x100
+	tcCS7     = 0x200
+	tcCS8     = 0x300
+	tcCSTOPB  = 0x400
+	tcPARENB  = 0x1000
+	tcPARODD  = 0x2000
+	tcBOTHER  = 0x1f
+	tcCIBAUD  = 0xff0000
+	tcCMSPAR  = 0x40000000
+	tcCRTSCTS = 0x80000000
+
+	tcISIG   = 0x80
+	tcICANON = 0x100
+	tcECHO   = 0x8
+	tcECHONL = 0x10
+	tcIEXTEN = 0x400
+)
+
+var baudrates = []struct {
+	baudrate int
+	speed    tcflag
+}{
+	{0, 0x0},
+	{50, 0x1},
+	{75, 0x2},
+	{110, 0x3},
+	{134, 0x4},
+	{150, 0x5},
+	{200, 0x6},
+	{300, 0x7},
+	{600, 0x8},
+	{1200, 0x9},
+	{1800, 0xa},
+	{2400, 0xb},
+	{4800, 0xc},
+	{9600, 0xd},
+	{19200, 0xe},
+	{38400, 0xf},
+	{57600, 0x10},
+	{115200, 0x11},
+	{230400, 0x12},
+	{460800, 0x13},
+	{500000, 0x14},
+	{576000, 0x15},
+	{921600, 0x16},
+	{1000000, 0x17},
+	{1152000, 0x18},
+	{1500000, 0x19},
+	{2000000, 0x1a},
+	{2500000, 0x1b},
+	{3000000, 0x1c},
+	{3500000, 0x1d},
+	{4000000, 0x1e},
+}
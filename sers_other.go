@@ -0,0 +1,9 @@
+// +build !darwin,!linux,!windows
+
+package sers
+
+// open opens the serial port fn, which is not a URL. Device paths are not
+// supported on this platform, only URLs of schemes that do not need them.
+func (o Opener) open(fn string) (SerialPort, error) {
+	return nil, StringError("opening serial ports is not supported on this platform")
+}
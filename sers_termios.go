@@ -6,33 +6,62 @@ package sers
 // Use of this source code is governed by an MIT-style
 // license that can be found in the LICENSE file.
 
-/*#include <stddef.h>
-#include <stdlib.h>
-#include <termios.h>
-#include <sys/ioctl.h>
-
-
- extern int ioctl1(int i, unsigned int r, void *d);
-*/
-import "C"
-
 import (
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"sync"
 	"syscall"
-	"unsafe"
+	"time"
 )
 
+// baseport implements net.Conn in addition to SerialPort.
+var _ net.Conn = (*baseport)(nil)
+
 type baseport struct {
 	fd           int
 	f            *os.File
 	platformData termiosPlatformData
+
+	// pty is set for the ends of pseudo terminals opened by OpenPTYPair,
+	// whose modem lines are emulated by softModem.
+	pty       bool
+	softModem softModem
+
+	rs485 rs485State
+
+	// closed is closed by Close so that operations that wait on something
+	// other than the file itself can be unblocked.
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// closeLock is held for reading by operations that check closed and
+	// then use fd outside of the runtime poller, so that Close cannot
+	// close the file in between.
+	closeLock sync.RWMutex
+
+	// lockfile is the path of the UUCP lock file, if one has been created.
+	lockfile string
+
+	// the runtime poller only reports a tty as readable once there is data,
+	// so the timeout set through SetReadParams is applied as a read
+	// deadline, combined with the one set through SetReadDeadline.
+	rl           sync.Mutex
+	readDeadline time.Time
+	readTimeout  time.Duration
+
+	// for the same reason, the poller reports the port readable before
+	// minread bytes have arrived if a Read starts while some are queued.
+	// readMin is the minread to wait for in that case, 0 if VMIN works by
+	// itself.
+	readMin int
 }
 
-func takeOverFD(fd int, fn string) (SerialPort, error) {
+func takeOverFD(fd int, fn string) (*baseport, error) {
 	bp := &baseport{
-		fd: fd,
+		fd:     fd,
+		closed: make(chan struct{}),
 	}
 
 	tio, err := bp.getattr()
@@ -40,7 +69,7 @@ func takeOverFD(fd int, fn string) (SerialPort, error) {
 		return nil, &Error{"putting fd in non-canonical mode", err}
 	}
 
-	C.cfmakeraw(tio)
+	makeraw(tio)
 
 	err = bp.setattr(tio)
 	if err != nil {
@@ -62,22 +91,118 @@ func TakeOver(f *os.File) (SerialPort, error) {
 	if f == nil {
 		return nil, &ParameterError{"f", "needs to be non-nil"}
 	}
-	bp := &baseport{fd: int(f.Fd()), f: f}
+	bp := &baseport{fd: int(f.Fd()), f: f, closed: make(chan struct{})}
 
 	return bp, nil
 }
 
 func (bp *baseport) Read(b []byte) (int, error) {
-	n, err := bp.f.Read(b)
+	if err := bp.armReadTimeout(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	var err error
+	if min := bp.minRead(len(b)); min > 1 {
+		n, err = bp.readAtLeast(b, min)
+	} else {
+		n, err = bp.f.Read(b)
+	}
 
 	// timeout gets reported as EOF
-	if err == io.EOF {
+	if err == io.EOF || (os.IsTimeout(err) && bp.readTimeoutExpired()) {
 		err = termiosSersTimeout{}
 	}
 	return n, err
 }
 
+// armReadTimeout sets the read deadline for a Read about to start, taking
+// into account the read timeout and the read deadline.
+func (bp *baseport) armReadTimeout() error {
+	bp.rl.Lock()
+	defer bp.rl.Unlock()
+
+	if bp.readTimeout == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(bp.readTimeout)
+	if !bp.readDeadline.IsZero() && bp.readDeadline.Before(deadline) {
+		deadline = bp.readDeadline
+	}
+
+	err := bp.f.SetReadDeadline(deadline)
+	if err == os.ErrNoDeadline {
+		// the file is in blocking mode, so VTIME works by itself
+		err = nil
+	}
+	return err
+}
+
+// minRead returns the number of bytes a Read into a buffer of size n has to
+// wait for.
+func (bp *baseport) minRead(n int) int {
+	bp.rl.Lock()
+	defer bp.rl.Unlock()
+
+	if bp.readMin < n {
+		return bp.readMin
+	}
+	return n
+}
+
+// readAtLeast reads into b once at least min bytes are queued, like a
+// blocking read with VMIN set does.
+func (bp *baseport) readAtLeast(b []byte, min int) (int, error) {
+	rc, err := bp.f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var rerr error
+	err = rc.Read(func(fd uintptr) bool {
+		queued, qerr := bp.queued(true)
+		if qerr == nil && queued < min {
+			// wait for more data
+			return false
+		}
+		n, rerr = syscall.Read(int(fd), b)
+		return rerr != syscall.EAGAIN
+	})
+	if err == nil {
+		err = rerr
+	}
+	if n < 0 {
+		n = 0
+	}
+	if err != nil {
+		return n, &os.PathError{Op: "read", Path: bp.f.Name(), Err: err}
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// readTimeoutExpired tells whether a Read that has hit a deadline did so
+// because of the read timeout rather than the read deadline.
+func (bp *baseport) readTimeoutExpired() bool {
+	bp.rl.Lock()
+	defer bp.rl.Unlock()
+
+	return bp.readTimeout > 0 && (bp.readDeadline.IsZero() || time.Now().Before(bp.readDeadline))
+}
+
 func (b *baseport) Close() error {
+	b.closeOnce.Do(func() {
+		b.closeLock.Lock()
+		close(b.closed)
+		b.closeLock.Unlock()
+		if b.lockfile != "" {
+			os.Remove(b.lockfile)
+		}
+	})
 	return b.f.Close()
 }
 
@@ -85,23 +210,68 @@ func (bp *baseport) Write(b []byte) (int, error) {
 	return bp.f.Write(b)
 }
 
-func (bp *baseport) getattr() (*C.struct_termios, error) {
-	var tio C.struct_termios
-	res, err := C.tcgetattr(C.int(bp.fd), (*C.struct_termios)(unsafe.Pointer(&tio)))
-	if res != 0 || err != nil {
-		return nil, err
+// SetDeadline sets the read and write deadlines of the port. It is
+// equivalent to calling both SetReadDeadline and SetWriteDeadline.
+//
+// Deadlines are handled by the runtime poller and can be combined with the
+// read parameters set through SetReadParams. A zero value for t means that
+// I/O operations will not time out. Ports obtained through TakeOver do not
+// support deadlines.
+func (bp *baseport) SetDeadline(t time.Time) error {
+	if err := bp.SetReadDeadline(t); err != nil {
+		return err
 	}
+	return bp.f.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future and currently blocked Read
+// calls. A Read that hits the deadline returns an error whose Timeout method
+// reports true. If a read timeout has been set through SetReadParams as
+// well, whichever expires first ends the Read.
+func (bp *baseport) SetReadDeadline(t time.Time) error {
+	bp.rl.Lock()
+	defer bp.rl.Unlock()
 
-	return &tio, nil
+	bp.readDeadline = t
+	return bp.f.SetReadDeadline(t)
 }
 
-func (bp *baseport) setattr(tio *C.struct_termios) error {
-	res, err := C.tcsetattr(C.int(bp.fd), C.TCSANOW, (*C.struct_termios)(unsafe.Pointer(tio)))
-	if res != 0 || err != nil {
-		return err
+// SetWriteDeadline sets the deadline for future and currently blocked Write
+// calls. Even if a Write times out it may have written some bytes already,
+// which is reflected in the returned count.
+func (bp *baseport) SetWriteDeadline(t time.Time) error {
+	return bp.f.SetWriteDeadline(t)
+}
+
+// LocalAddr returns a *SerialAddr describing the port and its current mode.
+func (bp *baseport) LocalAddr() net.Addr {
+	return bp.addr()
+}
+
+// RemoteAddr returns the same address as LocalAddr. A serial line has no
+// addressing of its own, so the local device is the best description of the
+// connection that is available.
+func (bp *baseport) RemoteAddr() net.Addr {
+	return bp.addr()
+}
+
+func (bp *baseport) addr() *SerialAddr {
+	sa := &SerialAddr{Path: bp.f.Name()}
+	if mode, err := bp.GetMode(); err == nil {
+		sa.Mode = mode
 	}
+	return sa
+}
 
-	return nil
+// makeraw puts tio into raw mode, the same way cfmakeraw(3) does.
+func makeraw(tio *termios) {
+	tio.Iflag &^= tcIGNBRK | tcBRKINT | tcPARMRK | tcISTRIP | tcINLCR | tcIGNCR | tcICRNL | tcIXON
+	tio.Oflag &^= tcOPOST
+	tio.Lflag &^= tcECHO | tcECHONL | tcICANON | tcISIG | tcIEXTEN
+	tio.Cflag &^= tcCSIZE | tcPARENB
+	tio.Cflag |= tcCS8
+	tio.Cc[tcVMIN] = 1
+	tio.Cc[tcVTIME] = 0
 }
 
 func (bp *baseport) SetMode(baudrate, databits, parity, stopbits, handshake int) error {
@@ -109,16 +279,16 @@ func (bp *baseport) SetMode(baudrate, databits, parity, stopbits, handshake int)
 		return &ParameterError{"baudrate", "has to be > 0"}
 	}
 
-	var datamask uint
+	var datamask tcflag
 	switch databits {
 	case 5:
-		datamask = C.CS5
+		datamask = tcCS5
 	case 6:
-		datamask = C.CS6
+		datamask = tcCS6
 	case 7:
-		datamask = C.CS7
+		datamask = tcCS7
 	case 8:
-		datamask = C.CS8
+		datamask = tcCS8
 	default:
 		return &ParameterError{"databits", "has to be 5, 6, 7 or 8"}
 	}
@@ -126,31 +296,43 @@ func (bp *baseport) SetMode(baudrate, databits, parity, stopbits, handshake int)
 	if stopbits != 1 && stopbits != 2 {
 		return &ParameterError{"stopbits", "has to be 1 or 2"}
 	}
-	var stopmask uint
+	var stopmask tcflag
 	if stopbits == 2 {
-		stopmask = C.CSTOPB
+		stopmask = tcCSTOPB
 	}
 
-	var parmask uint
+	var parmask tcflag
 	switch parity {
 	case N:
 		parmask = 0
 	case E:
-		parmask = C.PARENB
+		parmask = tcPARENB
 	case O:
-		parmask = C.PARENB | C.PARODD
+		parmask = tcPARENB | tcPARODD
+	case M, S:
+		if tcCMSPAR == 0 {
+			return &ParameterError{"parity", "mark and space parity are not supported on this platform"}
+		}
+		parmask = tcPARENB | tcCMSPAR
+		if parity == M {
+			parmask |= tcPARODD
+		}
 	default:
-		return &ParameterError{"parity", "has to be N, E or O"}
+		return &ParameterError{"parity", "has to be N, E, O, M or S"}
 	}
 
-	var flowmask uint
+	var flowmask, swflowmask tcflag
 	switch handshake {
 	case NO_HANDSHAKE:
 		flowmask = 0
 	case RTSCTS_HANDSHAKE:
-		flowmask = C.CRTSCTS
+		flowmask = tcCRTSCTS
+	case XONXOFF_HANDSHAKE:
+		swflowmask = tcIXON | tcIXOFF | tcIXANY
+	case RS485_HANDSHAKE:
+		// RTS is controlled by the driver, see rs485State below
 	default:
-		return &ParameterError{"handshake", "has to be NO_HANDSHAKE or RTSCTS_HANDSHAKE"}
+		return &ParameterError{"handshake", "has to be NO_HANDSHAKE, RTSCTS_HANDSHAKE, XONXOFF_HANDSHAKE or RS485_HANDSHAKE"}
 	}
 
 	tio, err := bp.getattr()
@@ -158,17 +340,20 @@ func (bp *baseport) SetMode(baudrate, databits, parity, stopbits, handshake int)
 		return &Error{"getattr", err}
 	}
 
-	tio.c_cflag &^= C.CSIZE
-	tio.c_cflag |= C.tcflag_t(datamask)
+	tio.Cflag &^= tcCSIZE
+	tio.Cflag |= datamask
+
+	tio.Cflag &^= tcPARENB | tcPARODD | tcCMSPAR
+	tio.Cflag |= parmask
 
-	tio.c_cflag &^= C.PARENB | C.PARODD
-	tio.c_cflag |= C.tcflag_t(parmask)
+	tio.Cflag &^= tcCSTOPB
+	tio.Cflag |= stopmask
 
-	tio.c_cflag &^= C.CSTOPB
-	tio.c_cflag |= C.tcflag_t(stopmask)
+	tio.Cflag &^= tcCRTSCTS
+	tio.Cflag |= flowmask
 
-	tio.c_cflag &^= C.CRTSCTS
-	tio.c_cflag |= C.tcflag_t(flowmask)
+	tio.Iflag &^= tcIXON | tcIXOFF | tcIXANY
+	tio.Iflag |= swflowmask
 
 	if err := bp.setattr(tio); err != nil {
 		return &Error{"setattr", err}
@@ -178,46 +363,100 @@ func (bp *baseport) SetMode(baudrate, databits, parity, stopbits, handshake int)
 		return err
 	}
 
+	return bp.rs485.setHandshake(handshake, bp.setRS485Mode)
+}
+
+// rs485State tracks whether RS-485 mode has been switched on by SetMode
+// because of RS485_HANDSHAKE. Only then do other handshake settings switch
+// it off again; RS-485 mode configured through SetRS485 is left alone.
+type rs485State struct {
+	lock      sync.Mutex
+	handshake bool
+}
+
+// setHandshake switches RS-485 mode on or off through set if handshake
+// changes to or from RS485_HANDSHAKE. set reports whether it has changed the
+// mode of the driver.
+func (rs *rs485State) setHandshake(handshake int, set func(on bool) (bool, error)) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	on := handshake == RS485_HANDSHAKE
+	if on == rs.handshake {
+		return nil
+	}
+	changed, err := set(on)
+	if err != nil {
+		return err
+	}
+	// if the mode was on already, it has been set up through SetRS485,
+	// e.g. when restoring a mode obtained by GetMode, and stays there.
+	rs.handshake = on && changed
+	return nil
+}
+
+// configure runs set, which configures RS-485 mode for SetRS485. Afterwards,
+// the mode is no longer considered to be switched on by SetMode.
+func (rs *rs485State) configure(set func() error) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	if err := set(); err != nil {
+		return err
+	}
+	rs.handshake = false
 	return nil
 }
 
 func (bp *baseport) GetMode() (mode Mode, err error) {
-	var tio *C.struct_termios
+	var tio *termios
 	tio, err = bp.getattr()
 	if err != nil {
 		return
 	}
 
-	tioCharSize := tio.c_cflag & C.CSIZE
+	tioCharSize := tio.Cflag & tcCSIZE
 	switch tioCharSize {
-	case C.CS5:
+	case tcCS5:
 		mode.DataBits = 5
-	case C.CS6:
+	case tcCS6:
 		mode.DataBits = 6
-	case C.CS7:
+	case tcCS7:
 		mode.DataBits = 7
-	case C.CS8:
+	case tcCS8:
 		mode.DataBits = 8
 	default:
 		err = fmt.Errorf("unknown character size field (%#08x) in termios", tioCharSize)
 	}
 
 	mode.Stopbits = 1
-	if tio.c_cflag&C.CSTOPB != 0 {
+	if tio.Cflag&tcCSTOPB != 0 {
 		mode.Stopbits = 2
 	}
 
 	mode.Parity = N
-	switch tio.c_cflag & (C.PARENB | C.PARODD) {
-	case C.PARENB | C.PARODD:
-		mode.Parity = O
-	case C.PARENB:
-		mode.Parity = E
+	if tio.Cflag&tcPARENB != 0 {
+		odd := tio.Cflag&tcPARODD != 0
+		sticky := tio.Cflag&tcCMSPAR != 0
+		switch {
+		case sticky && odd:
+			mode.Parity = M
+		case sticky:
+			mode.Parity = S
+		case odd:
+			mode.Parity = O
+		default:
+			mode.Parity = E
+		}
 	}
 
 	mode.Handshake = NO_HANDSHAKE
-	if tio.c_cflag&C.CRTSCTS != 0 {
+	if tio.Cflag&tcCRTSCTS != 0 {
 		mode.Handshake = RTSCTS_HANDSHAKE
+	} else if tio.Iflag&(tcIXON|tcIXOFF) != 0 {
+		mode.Handshake = XONXOFF_HANDSHAKE
+	} else if bp.rs485Enabled() {
+		mode.Handshake = RS485_HANDSHAKE
 	}
 
 	mode.Baudrate, err = bp.getBaudrate()
@@ -244,29 +483,52 @@ func (bp *baseport) SetReadParams(minread int, timeout float64) error {
 		return &Error{"getattr", err}
 	}
 
-	tio.c_cc[C.VMIN] = C.cc_t(minread)
-	tio.c_cc[C.VTIME] = C.cc_t(inttimeout)
+	tio.Cc[tcVMIN] = uint8(minread)
+	tio.Cc[tcVTIME] = uint8(inttimeout)
 
-	//fmt.Printf("baud rates from termios: %d, %d\n", tio.c_ispeed, tio.c_ospeed)
+	//fmt.Printf("baud rates from termios: %d, %d\n", tio.Ispeed, tio.Ospeed)
 
 	err = bp.setattr(tio)
 	if err != nil {
 		return &Error{"setattr", err}
 	}
 
+	// with minread > 0, the timer only starts after the first byte. as
+	// the poller reports the port readable as soon as there is any data,
+	// there is nothing left to emulate in that case.
+	bp.rl.Lock()
+	defer bp.rl.Unlock()
+	bp.readTimeout = 0
+	if minread == 0 {
+		bp.readTimeout = time.Duration(inttimeout) * 100 * time.Millisecond
+	}
+	bp.readMin = 0
+	// drop a deadline armed for the previous read timeout
+	err = bp.f.SetReadDeadline(bp.readDeadline)
+	if err == os.ErrNoDeadline {
+		// the file is in blocking mode, so VMIN works by itself
+		return nil
+	}
+	if err != nil {
+		return &Error{"setting read deadline", err}
+	}
+	if inttimeout == 0 {
+		bp.readMin = minread
+	}
+
 	return nil
 }
 
 func (bp *baseport) SetBreak(on bool) error {
 	var (
-		op       C.uint = C.TIOCCBRK
-		opstring string = "setting break"
+		op       uint   = syscall.TIOCCBRK
+		opstring string = "clearing break"
 	)
 	if on {
-		op, opstring = C.TIOCSBRK, "clearing break"
+		op, opstring = syscall.TIOCSBRK, "setting break"
 	}
 
-	_, err := C.ioctl1(C.int(bp.fd), op, unsafe.Pointer(&on))
+	err := bp.ioctl(op, nil)
 	if err != nil {
 		return &Error{fmt.Sprintf("ioctl: %s", opstring), err}
 	}
@@ -274,7 +536,35 @@ func (bp *baseport) SetBreak(on bool) error {
 	return nil
 }
 
-func Open(fn string) (SerialPort, error) {
+// open opens the serial port fn, which is not a URL, with the options set in
+// o.
+func (o Opener) open(fn string) (SerialPort, error) {
+	fn, err := resolvePortName(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock string
+	if o.LockFile {
+		lock, err = o.lock(fn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := openTermios(fn, o.Exclusive)
+	if err != nil {
+		if lock != "" {
+			os.Remove(lock)
+		}
+		return nil, err
+	}
+	s.lockfile = lock
+
+	return s, nil
+}
+
+func openTermios(fn string, exclusive bool) (*baseport, error) {
 	// the order of system calls is taken from Apple's SerialPortSample
 	// open the TTY device read/write, nonblocking, i.e. not waiting
 	// for the CARRIER signal and without the TTY controlling the process
@@ -282,12 +572,24 @@ func Open(fn string) (SerialPort, error) {
 		syscall.O_NOCTTY|
 		syscall.O_NONBLOCK,
 		0666)
+	if err == syscall.EBUSY {
+		return nil, &ErrPortBusy{Device: fn, PID: busyPID(fn)}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("open %s: %v", fn, err)
 	}
 
+	if exclusive {
+		bp := &baseport{fd: fd}
+		if err := bp.ioctl(syscall.TIOCEXCL, nil); err != nil {
+			syscall.Close(fd)
+			return nil, &Error{"ioctl: setting exclusive mode", err}
+		}
+	}
+
 	s, err := takeOverFD(fd, fn)
 	if err != nil {
+		syscall.Close(fd)
 		return nil, err
 	}
 
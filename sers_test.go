@@ -51,3 +51,22 @@ func readFirstBytesFromPort(fn string) ([]byte, error) {
 
 	return rb[:n], err
 }
+
+// This program lists the serial ports of the system together with the USB
+// metadata of the ones that belong to USB adapters.
+func ExampleListPorts() {
+	ports, err := sers.ListPorts()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, p := range ports {
+		if p.IsUSB() {
+			fmt.Printf("%s: %04x:%04x %s %s, serial number %q\n",
+				p.Device, p.VID, p.PID, p.Manufacturer, p.Product,
+				p.SerialNumber)
+		} else {
+			fmt.Printf("%s: %s on %s\n", p.Device, p.Driver, p.Bus)
+		}
+	}
+}
@@ -11,6 +11,7 @@ package sers
 // license that can be found in the LICENSE file.
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
@@ -25,6 +26,11 @@ type serialPort struct {
 	wl sync.Mutex
 	ro *syscall.Overlapped
 	wo *syscall.Overlapped
+
+	// the state of DTR and RTS can not be queried, so we keep track of
+	// it ourselves.
+	ml      sync.Mutex
+	outputs ModemLine
 }
 
 type structDCB struct {
@@ -54,8 +60,19 @@ func (o opError) Error() string {
 	return o.op + " " + o.filename + ": " + o.err.Error()
 }
 
-//func openPort(name string) (rwc io.ReadWriteCloser, err error) { // TODO
-func Open(name string) (rwc SerialPort, err error) {
+// open opens the serial port name, which is not a URL, with the options set
+// in o. Ports are always opened exclusively on Windows, lock files are not
+// supported.
+func (o Opener) open(name string) (rwc SerialPort, err error) {
+	if o.LockFile {
+		return nil, &ParameterError{"LockFile", "lock files are not supported on Windows"}
+	}
+
+	name, err = resolvePortName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(name) > 0 && name[0] != '\\' {
 		name = "\\\\.\\" + name
 	}
@@ -67,6 +84,9 @@ func Open(name string) (rwc SerialPort, err error) {
 		syscall.OPEN_EXISTING,
 		syscall.FILE_ATTRIBUTE_NORMAL|syscall.FILE_FLAG_OVERLAPPED,
 		0)
+	if err == syscall.ERROR_ACCESS_DENIED {
+		return nil, &ErrPortBusy{Device: name}
+	}
 	if err != nil {
 		return nil, opError{"open", name, err}
 	}
@@ -104,6 +124,12 @@ func Open(name string) (rwc SerialPort, err error) {
 	port.ro = ro
 	port.wo = wo
 
+	var params structDCB
+	if err = getCommState(h, &params); err != nil {
+		return
+	}
+	port.outputs = dcbOutputs(&params)
+
 	return port, nil
 }
 
@@ -180,6 +206,197 @@ func (p *serialPort) SetBreak(on bool) error {
 	return nil
 }
 
+var _ ModemLines = (*serialPort)(nil)
+
+const (
+	escSETRTS = 3
+	escCLRRTS = 4
+	escSETDTR = 5
+	escCLRDTR = 6
+
+	msCTSON  = 0x10
+	msDSRON  = 0x20
+	msRINGON = 0x40
+	msRLSDON = 0x80
+)
+
+func (p *serialPort) SetDTR(on bool) error {
+	return p.setOutputs(DTR, lineIf(DTR, on))
+}
+
+func (p *serialPort) SetRTS(on bool) error {
+	return p.setOutputs(RTS, lineIf(RTS, on))
+}
+
+func (p *serialPort) SetModemLines(lines ModemLine) error {
+	return p.setOutputs(DTR|RTS, lines)
+}
+
+// setOutputs asserts the lines in mask that are contained in lines and
+// deasserts the remaining ones in mask.
+func (p *serialPort) setOutputs(mask, lines ModemLine) error {
+	p.ml.Lock()
+	defer p.ml.Unlock()
+
+	escapes := []struct {
+		line     ModemLine
+		set, clr uintptr
+	}{
+		{DTR, escSETDTR, escCLRDTR},
+		{RTS, escSETRTS, escCLRRTS},
+	}
+
+	for _, e := range escapes {
+		if mask&e.line == 0 {
+			continue
+		}
+		fn := e.clr
+		if lines&e.line != 0 {
+			fn = e.set
+		}
+		r, _, err := syscall.Syscall(nEscapeCommFunction, 2, uintptr(p.fd), fn, 0)
+		if r == 0 {
+			return &Error{"EscapeCommFunction", err}
+		}
+	}
+
+	p.outputs = p.outputs&^mask | lines&mask
+	return nil
+}
+
+func (p *serialPort) GetModemLines() (ModemLine, error) {
+	var status uint32
+	r, _, err := syscall.Syscall(nGetCommModemStatus, 2, uintptr(p.fd), uintptr(unsafe.Pointer(&status)), 0)
+	if r == 0 {
+		return 0, &Error{"GetCommModemStatus", err}
+	}
+
+	lines := p.getOutputs()
+	if status&msCTSON != 0 {
+		lines |= CTS
+	}
+	if status&msDSRON != 0 {
+		lines |= DSR
+	}
+	if status&msRLSDON != 0 {
+		lines |= DCD
+	}
+	if status&msRINGON != 0 {
+		lines |= RI
+	}
+
+	return lines, nil
+}
+
+func (p *serialPort) getOutputs() ModemLine {
+	p.ml.Lock()
+	defer p.ml.Unlock()
+	return p.outputs
+}
+
+func lineIf(line ModemLine, on bool) ModemLine {
+	if on {
+		return line
+	}
+	return 0
+}
+
+// dcbOutputs derives the state of DTR and RTS from the fDtrControl and
+// fRtsControl fields of a DCB.
+func dcbOutputs(params *structDCB) ModemLine {
+	const controlEnable = 1
+
+	var lines ModemLine
+	if (params.flags[0]>>4)&0x03 == controlEnable {
+		lines |= DTR
+	}
+	if (params.flags[1]>>4)&0x03 == controlEnable {
+		lines |= RTS
+	}
+	return lines
+}
+
+var _ Flusher = (*serialPort)(nil)
+
+const (
+	purgeTXABORT = 0x0001
+	purgeRXABORT = 0x0002
+	purgeTXCLEAR = 0x0004
+	purgeRXCLEAR = 0x0008
+)
+
+func (p *serialPort) purge(flags uintptr) error {
+	r, _, err := syscall.Syscall(nPurgeComm, 2, uintptr(p.fd), flags, 0)
+	if r == 0 {
+		return &Error{"PurgeComm", err}
+	}
+	return nil
+}
+
+func (p *serialPort) FlushInput() error {
+	return p.purge(purgeRXABORT | purgeRXCLEAR)
+}
+
+func (p *serialPort) FlushOutput() error {
+	return p.purge(purgeTXABORT | purgeTXCLEAR)
+}
+
+func (p *serialPort) Drain(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- syscall.FlushFileBuffers(p.fd)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return &Error{"FlushFileBuffers", err}
+		}
+		return nil
+	case <-ctx.Done():
+		p.FlushOutput()
+		<-done
+		return ctx.Err()
+	}
+}
+
+var _ QueueStatus = (*serialPort)(nil)
+
+// structComstat is COMSTAT, with the bit fields collapsed into flags.
+type structComstat struct {
+	flags    uint32
+	cbInQue  uint32
+	cbOutQue uint32
+}
+
+// comstat queries the state of the port. ClearCommError also resets the
+// error flags of the port, which sers does not evaluate anyway.
+func (p *serialPort) comstat() (*structComstat, error) {
+	var errors uint32
+	var stat structComstat
+	r, _, err := syscall.Syscall(nClearCommError, 3, uintptr(p.fd), uintptr(unsafe.Pointer(&errors)), uintptr(unsafe.Pointer(&stat)))
+	if r == 0 {
+		return nil, &Error{"ClearCommError", err}
+	}
+	return &stat, nil
+}
+
+func (p *serialPort) InputWaiting() (int, error) {
+	stat, err := p.comstat()
+	if err != nil {
+		return 0, err
+	}
+	return int(stat.cbInQue), nil
+}
+
+func (p *serialPort) OutputWaiting() (int, error) {
+	stat, err := p.comstat()
+	if err != nil {
+		return 0, err
+	}
+	return int(stat.cbOutQue), nil
+}
+
 var (
 	nSetCommState,
 	nGetCommState,
@@ -190,7 +407,11 @@ var (
 	nCreateEvent,
 	nResetEvent,
 	nSetCommBreak,
-	nClearCommBreak uintptr
+	nClearCommBreak,
+	nEscapeCommFunction,
+	nGetCommModemStatus,
+	nPurgeComm,
+	nClearCommError uintptr
 )
 
 func init() {
@@ -210,6 +431,10 @@ func init() {
 	nResetEvent = getProcAddr(k32, "ResetEvent")
 	nSetCommBreak = getProcAddr(k32, "SetCommBreak")
 	nClearCommBreak = getProcAddr(k32, "ClearCommBreak")
+	nEscapeCommFunction = getProcAddr(k32, "EscapeCommFunction")
+	nGetCommModemStatus = getProcAddr(k32, "GetCommModemStatus")
+	nPurgeComm = getProcAddr(k32, "PurgeComm")
+	nClearCommError = getProcAddr(k32, "ClearCommError")
 }
 
 func getProcAddr(lib syscall.Handle, name string) uintptr {
@@ -242,6 +467,12 @@ func setCommState(h syscall.Handle, mode Mode) error {
 	case O:
 		params.flags[0] |= 0x02
 		params.Parity = 1 // ODDPARITY
+	case M:
+		params.flags[0] |= 0x02
+		params.Parity = 3 // MARKPARITY
+	case S:
+		params.flags[0] |= 0x02
+		params.Parity = 4 // SPACEPARITY
 	default:
 		return StringError("invalid parity setting")
 	}
@@ -260,12 +491,20 @@ func setCommState(h syscall.Handle, mode Mode) error {
 	return nil
 }
 
+func getCommState(h syscall.Handle, params *structDCB) error {
+	params.DCBlength = uint32(unsafe.Sizeof(*params))
+	r, _, err := syscall.Syscall(nGetCommState, 2, uintptr(h), uintptr(unsafe.Pointer(params)), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
 func (sp *serialPort) GetMode() (Mode, error) {
 	var params structDCB
 	var mode Mode = Mode{Handshake: NO_HANDSHAKE, Parity: N, Stopbits: 1}
 
-	r, _, err := syscall.Syscall(nGetCommState, 2, uintptr(syscall.Handle(sp.f.Fd())), uintptr(unsafe.Pointer(&params)), 0)
-	if r == 0 {
+	if err := getCommState(syscall.Handle(sp.f.Fd()), &params); err != nil {
 		return mode, err
 	}
 
@@ -285,6 +524,10 @@ func (sp *serialPort) GetMode() (Mode, error) {
 			mode.Parity = O
 		case 2:
 			mode.Parity = E
+		case 3:
+			mode.Parity = M
+		case 4:
+			mode.Parity = S
 		default:
 			return mode, fmt.Errorf("error getting mode: unsupport Parity setting %d", params.Parity)
 		}
@@ -394,6 +637,11 @@ func (sp *serialPort) SetMode(baudrate, databits, parity, stopbits, handshake in
 	if err := setCommState(syscall.Handle(sp.f.Fd()), mode); err != nil {
 		return err
 	}
+
+	// setCommState enables DTR and disables RTS
+	sp.ml.Lock()
+	sp.outputs = DTR
+	sp.ml.Unlock()
 	//return StringError("SetMode not implemented yet on Windows")
 	return nil
 }
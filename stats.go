@@ -0,0 +1,60 @@
+package sers
+
+import "time"
+
+// LineStats is a snapshot of the counters a serial driver keeps for a port.
+// The counters start at zero when the driver initializes the port and wrap
+// around on overflow.
+type LineStats struct {
+	// Time is the point in time the snapshot was taken.
+	Time time.Time
+
+	Rx uint32 // received bytes
+	Tx uint32 // transmitted bytes
+
+	Frame      uint32 // framing errors
+	Parity     uint32 // parity errors
+	Overrun    uint32 // bytes lost because the hardware FIFO overflowed
+	BufOverrun uint32 // bytes lost because the driver's buffer overflowed
+	Break      uint32 // received break conditions
+
+	CTS uint32 // transitions of CTS
+	DSR uint32 // transitions of DSR
+	RI  uint32 // trailing edges of RI
+	DCD uint32 // transitions of DCD
+}
+
+// Sub returns the change of the counters since prev. The result is correct
+// across a single wrap around of a counter. The Time of the result is that of
+// ls, the duration between the snapshots is ls.Time.Sub(prev.Time).
+func (ls LineStats) Sub(prev LineStats) LineStats {
+	return LineStats{
+		Time:       ls.Time,
+		Rx:         ls.Rx - prev.Rx,
+		Tx:         ls.Tx - prev.Tx,
+		Frame:      ls.Frame - prev.Frame,
+		Parity:     ls.Parity - prev.Parity,
+		Overrun:    ls.Overrun - prev.Overrun,
+		BufOverrun: ls.BufOverrun - prev.BufOverrun,
+		Break:      ls.Break - prev.Break,
+		CTS:        ls.CTS - prev.CTS,
+		DSR:        ls.DSR - prev.DSR,
+		RI:         ls.RI - prev.RI,
+		DCD:        ls.DCD - prev.DCD,
+	}
+}
+
+// Errors returns the sum of the framing, parity, overrun and buffer overrun
+// error counters. A high rate of framing and parity errors usually points to
+// a mismatch of the mode, while overruns hint at a reader that does not keep
+// up.
+func (ls LineStats) Errors() uint32 {
+	return ls.Frame + ls.Parity + ls.Overrun + ls.BufOverrun
+}
+
+// LineStatsReader is implemented by serial ports that provide driver
+// counters. On Linux, the serial ports returned by Open implement it.
+type LineStatsReader interface {
+	// LineStats returns a snapshot of the port's counters.
+	LineStats() (LineStats, error)
+}
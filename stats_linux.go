@@ -0,0 +1,29 @@
+// +build linux
+
+package sers
+
+import "time"
+
+var _ LineStatsReader = (*baseport)(nil)
+
+func (bp *baseport) LineStats() (LineStats, error) {
+	ic, err := bp.getIcount()
+	if err != nil {
+		return LineStats{}, &Error{"ioctl: getting line statistics", err}
+	}
+
+	return LineStats{
+		Time:       time.Now(),
+		Rx:         uint32(ic.Rx),
+		Tx:         uint32(ic.Tx),
+		Frame:      uint32(ic.Frame),
+		Parity:     uint32(ic.Parity),
+		Overrun:    uint32(ic.Overrun),
+		BufOverrun: uint32(ic.BufOverrun),
+		Break:      uint32(ic.Brk),
+		CTS:        uint32(ic.Cts),
+		DSR:        uint32(ic.Dsr),
+		RI:         uint32(ic.Rng),
+		DCD:        uint32(ic.Dcd),
+	}, nil
+}
@@ -0,0 +1,24 @@
+package sers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLineStatsSub(t *testing.T) {
+	t0 := time.Now()
+	t1 := t0.Add(time.Second)
+
+	prev := LineStats{Time: t0, Rx: 100, Tx: 1<<32 - 10, Frame: 3, DCD: 1}
+	cur := LineStats{Time: t1, Rx: 150, Tx: 5, Frame: 7, Parity: 2, Overrun: 1, BufOverrun: 3, DCD: 2}
+
+	d := cur.Sub(prev)
+	exp := LineStats{Time: t1, Rx: 50, Tx: 15, Frame: 4, Parity: 2, Overrun: 1, BufOverrun: 3, DCD: 1}
+	if d != exp {
+		t.Errorf("got %+v, want %+v", d, exp)
+	}
+
+	if errs := d.Errors(); errs != 10 {
+		t.Errorf("got %d errors, want 10", errs)
+	}
+}
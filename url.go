@@ -0,0 +1,233 @@
+package sers
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Driver opens the serial ports named by URLs of a scheme, see
+// RegisterDriver.
+type Driver interface {
+	// Open opens the port described by u. The parameters mode, timeout
+	// and minread are applied by Open afterwards, all other parameters
+	// are up to the driver.
+	Open(u *url.URL) (SerialPort, error)
+}
+
+// DriverFunc adapts a function to the Driver interface.
+type DriverFunc func(u *url.URL) (SerialPort, error)
+
+// Open calls f(u).
+func (f DriverFunc) Open(u *url.URL) (SerialPort, error) {
+	return f(u)
+}
+
+var (
+	driversLock sync.RWMutex
+	drivers     = make(map[string]Driver)
+)
+
+// RegisterDriver makes Open use d for URLs with the given scheme. Schemes
+// are case insensitive. RegisterDriver panics if d is nil or a driver for
+// scheme has already been registered, which includes the built-in schemes
+// file, tcp, rfc2217, loop and pty.
+func RegisterDriver(scheme string, d Driver) {
+	if d == nil {
+		panic("sers: RegisterDriver driver is nil")
+	}
+	scheme = strings.ToLower(scheme)
+
+	driversLock.Lock()
+	defer driversLock.Unlock()
+	if _, dup := drivers[scheme]; dup {
+		panic("sers: RegisterDriver called twice for scheme " + scheme)
+	}
+	drivers[scheme] = d
+}
+
+func init() {
+	RegisterDriver("file", DriverFunc(Opener{}.openFileURL))
+	RegisterDriver("tcp", DriverFunc(openTCPURL))
+	RegisterDriver("rfc2217", DriverFunc(openRFC2217URL))
+	RegisterDriver("loop", DriverFunc(openLoopURL))
+	RegisterDriver("pty", DriverFunc(openPTYURL))
+}
+
+// isURL reports whether name starts with a URL scheme followed by "://".
+// Device paths and port selectors never do.
+func isURL(name string) bool {
+	i := strings.Index(name, "://")
+	if i <= 0 {
+		return false
+	}
+	for j, c := range name[:i] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case j > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// openURL opens the port described by the URL name. The options set in o are
+// passed on to the file driver.
+func (o Opener) openURL(name string) (SerialPort, error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, &ParameterError{"name", err.Error()}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	driversLock.RLock()
+	d := drivers[scheme]
+	driversLock.RUnlock()
+	if scheme == "file" {
+		d = DriverFunc(o.openFileURL)
+	}
+	if d == nil {
+		return nil, &ParameterError{"name", fmt.Sprintf("no driver for scheme %q", u.Scheme)}
+	}
+
+	sp, err := d.Open(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyURLParams(sp, u.Query()); err != nil {
+		sp.Close()
+		return nil, err
+	}
+	return sp, nil
+}
+
+// urlParams are the parameters applied to ports of all schemes.
+var urlParams = []string{"mode", "timeout", "minread"}
+
+// applyURLParams sets the mode and read parameters given in q.
+func applyURLParams(sp SerialPort, q url.Values) error {
+	if ms := q.Get("mode"); ms != "" {
+		mode, err := ParseModestring(ms)
+		if err != nil {
+			return err
+		}
+		if err := SetModeStruct(sp, mode); err != nil {
+			return err
+		}
+	}
+
+	ts, ms := q.Get("timeout"), q.Get("minread")
+	if ts == "" && ms == "" {
+		return nil
+	}
+
+	var timeout time.Duration
+	if ts != "" {
+		var err error
+		timeout, err = time.ParseDuration(ts)
+		if err != nil || timeout < 0 {
+			return &ParameterError{"timeout", "has to be a duration of 0 or more, e.g. 500ms"}
+		}
+	}
+
+	minread := 0
+	if ms != "" {
+		var err error
+		minread, err = strconv.Atoi(ms)
+		if err != nil || minread < 0 {
+			return &ParameterError{"minread", "has to be a number of 0 or more"}
+		}
+	}
+
+	return sp.SetReadParams(minread, timeout.Seconds())
+}
+
+// checkURLParams returns an error for parameters in u that are neither
+// applied to all ports nor contained in allowed.
+func checkURLParams(u *url.URL, allowed ...string) error {
+	for name := range u.Query() {
+		known := false
+		for _, a := range append(allowed, urlParams...) {
+			known = known || name == a
+		}
+		if !known {
+			return &ParameterError{name, "unknown URL parameter for scheme " + u.Scheme}
+		}
+	}
+	return nil
+}
+
+// boolParam returns the value of the boolean parameter name.
+func boolParam(q url.Values, name string) (bool, error) {
+	s := q.Get(name)
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &ParameterError{name, "has to be true or false"}
+	}
+	return b, nil
+}
+
+// openFileURL opens the device named by a file URL. The parameters exclusive
+// and lock enable the respective options in addition to those set in o.
+func (o Opener) openFileURL(u *url.URL) (SerialPort, error) {
+	if err := checkURLParams(u, "exclusive", "lock"); err != nil {
+		return nil, err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, &ParameterError{"name", "file URLs cannot name ports on other hosts"}
+	}
+
+	fn := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///COM3
+		fn = strings.TrimPrefix(fn, "/")
+	}
+
+	q := u.Query()
+	exclusive, err := boolParam(q, "exclusive")
+	if err != nil {
+		return nil, err
+	}
+	lock, err := boolParam(q, "lock")
+	if err != nil {
+		return nil, err
+	}
+	o.Exclusive = o.Exclusive || exclusive
+	o.LockFile = o.LockFile || lock
+	return o.open(fn)
+}
+
+func openTCPURL(u *url.URL) (SerialPort, error) {
+	if err := checkURLParams(u); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	return newNetPort(conn), nil
+}
+
+func openRFC2217URL(u *url.URL) (SerialPort, error) {
+	if err := checkURLParams(u); err != nil {
+		return nil, err
+	}
+	return OpenRFC2217(u.Host)
+}
+
+func openLoopURL(u *url.URL) (SerialPort, error) {
+	if err := checkURLParams(u); err != nil {
+		return nil, err
+	}
+	return newLoopPort(), nil
+}
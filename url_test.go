@@ -0,0 +1,166 @@
+package sers
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestIsURL(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		url  bool
+	}{
+		{"/dev/ttyUSB0", false},
+		{"COM3", false},
+		{`\\.\COM10`, false},
+		{"usb:0403:6001:serial=A12345", false},
+		{"file:///dev/ttyS0", true},
+		{"loop://", true},
+		{"rfc2217://localhost:2217", true},
+		{"my-driver+v2://x", true},
+		{"://x", false},
+		{"2x://x", false},
+		{"/tmp/odd://name", false},
+	} {
+		if got := isURL(c.name); got != c.url {
+			t.Errorf("isURL(%q) = %v, want %v", c.name, got, c.url)
+		}
+	}
+}
+
+func TestOpenLoop(t *testing.T) {
+	sp, err := Open("loop://?mode=19200,7e1&timeout=100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	exp := Mode{19200, 7, E, 1, NO_HANDSHAKE}
+	if mode, err := sp.GetMode(); err != nil || mode != exp {
+		t.Errorf("GetMode() = %v, %v, want %v", mode, err, exp)
+	}
+
+	if _, err := sp.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := sp.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("Read returned %q, %v, want %q", buf[:n], err, "hello")
+	}
+
+	start := time.Now()
+	n, err = sp.Read(buf)
+	if to, ok := err.(interface{ Timeout() bool }); n != 0 || !ok || !to.Timeout() {
+		t.Errorf("Read returned %d, %v, want timeout", n, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond || d > 2*time.Second {
+		t.Errorf("Read timed out after %v, want about 100ms", d)
+	}
+
+	ml := sp.(ModemLines)
+	if err := ml.SetModemLines(RTS); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err := ml.GetModemLines(); err != nil || lines != RTS|CTS {
+		t.Errorf("GetModemLines() = %v, %v, want %v", lines, err, RTS|CTS)
+	}
+
+	sp.Close()
+	if _, err := sp.Read(buf); err != errPortClosed {
+		t.Errorf("Read after Close returned %v, want %v", err, errPortClosed)
+	}
+}
+
+func TestOpenTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	sp, err := Open("tcp://" + l.Addr().String() + "?mode=115200&minread=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	if mode, err := sp.GetMode(); err != nil || mode.Baudrate != 115200 {
+		t.Errorf("GetMode() = %v, %v", mode, err)
+	}
+	if err := sp.SetBreak(true); err == nil {
+		t.Error("SetBreak succeeded on a raw TCP port")
+	}
+
+	go func() {
+		sp.Write([]byte("ab"))
+		time.Sleep(50 * time.Millisecond)
+		sp.Write([]byte("cde"))
+	}()
+	buf := make([]byte, 16)
+	n, err := sp.Read(buf)
+	if err != nil || string(buf[:n]) != "abcde" {
+		t.Errorf("Read returned %q, %v, want %q", buf[:n], err, "abcde")
+	}
+}
+
+func TestOpenURLErrors(t *testing.T) {
+	for _, name := range []string{
+		"nosuchscheme://x",
+		"loop://?mode=fast",
+		"loop://?timeout=-1s",
+		"loop://?minread=x",
+		"loop://?colour=blue",
+		"file:///dev/null?exclusive=maybe",
+		"file://otherhost/dev/ttyS0",
+	} {
+		sp, err := Open(name)
+		if err == nil {
+			sp.Close()
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+}
+
+func TestRegisterDriver(t *testing.T) {
+	var opened *url.URL
+	RegisterDriver("Test-Loop", DriverFunc(func(u *url.URL) (SerialPort, error) {
+		opened = u
+		return newLoopPort(), nil
+	}))
+	defer func() {
+		driversLock.Lock()
+		delete(drivers, "test-loop")
+		driversLock.Unlock()
+	}()
+
+	sp, err := Open("test-loop://unit/7?mode=4800&colour=blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	if opened == nil || opened.Host != "unit" || opened.Path != "/7" || opened.Query().Get("colour") != "blue" {
+		t.Errorf("driver called with %v", opened)
+	}
+	if mode, _ := sp.GetMode(); mode.Baudrate != 4800 {
+		t.Errorf("mode parameter not applied, mode is %v", mode)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a scheme twice did not panic")
+		}
+	}()
+	RegisterDriver("loop", DriverFunc(openLoopURL))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/distributed/sers"
+)
+
+func main() {
+	err := Main()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var timeout = flag.Duration("timeout", 500*time.Millisecond, "read deadline, relative to now")
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+func Main() error {
+	flag.Parse()
+	if len(flag.Args()) < 1 {
+		return fmt.Errorf("please provide a serial file name")
+	}
+	fn := flag.Args()[0]
+
+	sp, err := sers.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer sp.Close()
+
+	rd, ok := sp.(readDeadliner)
+	if !ok {
+		return fmt.Errorf("serial port does not support read deadlines")
+	}
+
+	err = rd.SetReadDeadline(time.Now().Add(*timeout))
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	n, err := sp.Read(make([]byte, 128))
+	fmt.Printf("read returned after %v: n %d err %v\n", time.Since(start), n, err)
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package sers
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// PortEventType tells whether a port has appeared or disappeared.
+type PortEventType int
+
+const (
+	PortAdded PortEventType = iota + 1
+	PortRemoved
+)
+
+func (pet PortEventType) String() string {
+	switch pet {
+	case PortAdded:
+		return "added"
+	case PortRemoved:
+		return "removed"
+	}
+	return "invalid"
+}
+
+// PortEvent is delivered by a Watcher when a serial port has been added or
+// removed. For removed ports, Port describes the port as it was last seen.
+// If Err is non-nil, watching has failed and Type and Port are not set.
+type PortEvent struct {
+	Type PortEventType
+	Port PortInfo
+	Err  error
+}
+
+// PortEventSource tells a Watcher when the set of serial ports may have
+// changed.
+type PortEventSource interface {
+	// Wait blocks until the ports may have changed or ctx is done. Spurious
+	// wakeups are allowed, the Watcher compares the ports before and after.
+	Wait(ctx context.Context) error
+
+	Close() error
+}
+
+// PollSource is a PortEventSource that wakes up the Watcher in regular
+// intervals.
+type PollSource struct {
+	// Interval is the time between two scans, one second if zero.
+	Interval time.Duration
+}
+
+// Wait waits for the poll interval to pass.
+func (ps *PollSource) Wait(ctx context.Context) error {
+	interval := ps.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	t := time.NewTimer(interval)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close does nothing, a PollSource does not hold any resources.
+func (ps *PollSource) Close() error {
+	return nil
+}
+
+// Watcher reports serial ports as they appear and disappear, e.g. because a
+// USB adapter has been plugged in. The zero value watches the system's
+// ports, using kernel uevents if possible and falling back to polling
+// otherwise.
+type Watcher struct {
+	// Lister is used for enumerating the ports.
+	Lister PortLister
+
+	// Source tells the Watcher when to scan the ports again. If nil, a
+	// source suitable for the platform is created and closed again when
+	// watching ends. A Source provided here is left for the caller to
+	// close.
+	Source PortEventSource
+}
+
+// WatchPorts watches the system's serial ports. It is a shorthand for
+// calling Watch on a zero Watcher.
+func WatchPorts(ctx context.Context) (<-chan PortEvent, error) {
+	return (&Watcher{}).Watch(ctx)
+}
+
+// Watch delivers events for added and removed ports on the returned channel.
+// The ports present when Watch is called are reported as added first. The
+// channel is closed once ctx is done or after an event with a non-nil Err
+// has been delivered.
+func (w *Watcher) Watch(ctx context.Context) (<-chan PortEvent, error) {
+	src, own := w.Source, false
+	if src == nil {
+		src, own = defaultPortEventSource(), true
+	}
+
+	ports, err := w.Lister.List()
+	if err != nil {
+		if own {
+			src.Close()
+		}
+		return nil, err
+	}
+
+	ch := make(chan PortEvent)
+	go func() {
+		defer close(ch)
+		if own {
+			defer src.Close()
+		}
+
+		send := func(ev PortEvent) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		known := make(map[string]PortInfo)
+		for {
+			for _, ev := range diffPorts(known, ports) {
+				if !send(ev) {
+					return
+				}
+			}
+
+			err := src.Wait(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				ports, err = w.Lister.List()
+			}
+			if err != nil {
+				send(PortEvent{Err: err})
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// diffPorts updates known, indexed by device path, to ports and returns the
+// events describing the change. Removals are reported before additions, so
+// that a port replaced by another one under the same device path shows up
+// as removed and added again.
+func diffPorts(known map[string]PortInfo, ports []PortInfo) []PortEvent {
+	var removed, added []PortEvent
+
+	current := make(map[string]bool, len(ports))
+	for _, pi := range ports {
+		current[pi.Device] = true
+		old, ok := known[pi.Device]
+		if ok && samePort(&old, &pi) {
+			// pick up symlinks created after the port appeared
+			known[pi.Device] = pi
+			continue
+		}
+		if ok {
+			removed = append(removed, PortEvent{Type: PortRemoved, Port: old})
+		}
+		added = append(added, PortEvent{Type: PortAdded, Port: pi})
+		known[pi.Device] = pi
+	}
+
+	for dev, pi := range known {
+		if !current[dev] {
+			removed = append(removed, PortEvent{Type: PortRemoved, Port: pi})
+			delete(known, dev)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Port.Device < removed[j].Port.Device
+	})
+
+	return append(removed, added...)
+}
+
+// samePort reports whether a and b describe the same hardware. The udev
+// symlinks are not compared, as they may be created after the port shows up.
+func samePort(a, b *PortInfo) bool {
+	return a.Device == b.Device &&
+		a.Driver == b.Driver &&
+		a.Bus == b.Bus &&
+		a.VID == b.VID &&
+		a.PID == b.PID &&
+		a.SerialNumber == b.SerialNumber &&
+		a.Interface == b.Interface
+}
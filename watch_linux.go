@@ -0,0 +1,144 @@
+// +build linux
+
+package sers
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// UeventSource is a PortEventSource that listens for the uevents the kernel
+// sends when tty devices are added or removed.
+//
+// Kernel uevents are delivered before udev has processed the device, so the
+// ByID and ByPath symlinks of a freshly added port may not exist yet.
+type UeventSource struct {
+	f       *os.File
+	changes chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewUeventSource opens a netlink socket for receiving kernel uevents.
+func NewUeventSource() (*UeventSource, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK,
+		syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, &Error{"opening uevent socket", err}
+	}
+
+	// group 1 carries the events sent by the kernel itself
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, &Error{"binding uevent socket", err}
+	}
+
+	us := &UeventSource{
+		f:       os.NewFile(uintptr(fd), "uevent"),
+		changes: make(chan struct{}, 1),
+	}
+	go us.receive(us.f.Read)
+
+	return us, nil
+}
+
+// receive reads uevents with read until the socket is closed.
+func (us *UeventSource) receive(read func(p []byte) (int, error)) {
+	defer close(us.changes)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := read(buf)
+		if lostUevents(err) {
+			// the socket buffer overflowed, e.g. during the burst of
+			// uevents caused by plugging in a USB hub. The Watcher
+			// rescans to find out what has been missed.
+			us.wake()
+			continue
+		}
+		if err != nil {
+			us.mu.Lock()
+			us.err = &Error{"reading uevent", err}
+			us.mu.Unlock()
+			return
+		}
+
+		action, subsystem := parseUevent(buf[:n])
+		if subsystem != "tty" || (action != "add" && action != "remove") {
+			continue
+		}
+		us.wake()
+	}
+}
+
+func (us *UeventSource) wake() {
+	select {
+	case us.changes <- struct{}{}:
+	default:
+		// a wakeup is pending already
+	}
+}
+
+// lostUevents reports whether err from reading the netlink socket means that
+// uevents may have been dropped, but the socket can still be read.
+func lostUevents(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.ENOBUFS || err == syscall.EINTR
+}
+
+// Wait blocks until a tty device has been added or removed.
+func (us *UeventSource) Wait(ctx context.Context) error {
+	select {
+	case _, ok := <-us.changes:
+		if !ok {
+			us.mu.Lock()
+			defer us.mu.Unlock()
+			return us.err
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the netlink socket. Pending and future calls to Wait return
+// an error.
+func (us *UeventSource) Close() error {
+	return us.f.Close()
+}
+
+// parseUevent extracts action and subsystem from a kernel uevent message,
+// which consists of a header "action@devpath" followed by KEY=value pairs,
+// all terminated by NUL bytes.
+func parseUevent(msg []byte) (action, subsystem string) {
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		kv := bytes.SplitN(field, []byte{'='}, 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch string(kv[0]) {
+		case "ACTION":
+			action = string(kv[1])
+		case "SUBSYSTEM":
+			subsystem = string(kv[1])
+		}
+	}
+	return
+}
+
+func defaultPortEventSource() PortEventSource {
+	us, err := NewUeventSource()
+	if err != nil {
+		// netlink may be unavailable, e.g. in containers
+		return &PollSource{}
+	}
+	return us
+}
@@ -0,0 +1,226 @@
+package sers
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// chanSource is a PortEventSource triggered by the test. It announces on
+// idle when the Watcher is waiting, so that the test can modify the tree
+// without racing against a scan.
+type chanSource struct {
+	idle chan struct{}
+	wake chan error
+}
+
+func newChanSource() *chanSource {
+	return &chanSource{idle: make(chan struct{}), wake: make(chan error)}
+}
+
+func (cs *chanSource) Wait(ctx context.Context) error {
+	select {
+	case cs.idle <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-cs.wake:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (cs *chanSource) Close() error {
+	return nil
+}
+
+func TestWatcher(t *testing.T) {
+	root, err := ioutil.TempDir("", "sers-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	usbPort := func(n, serial string) map[string]string {
+		usb := "sys/devices/pci0000:00/0000:00:14.0/usb1/1-" + n
+		intf := usb + "/1-" + n + ":1.0"
+		tty := "ttyUSB" + n
+		return map[string]string{
+			usb + "/idVendor":                  "0403\n",
+			usb + "/idProduct":                 "6001\n",
+			usb + "/serial":                    serial + "\n",
+			intf + "/bInterfaceNumber":         "00\n",
+			intf + "/" + tty + "/driver":       "->sys/bus/usb-serial/drivers/ftdi_sio",
+			intf + "/" + tty + "/subsystem":    "->sys/bus/usb-serial",
+			"sys/class/tty/" + tty + "/device": "->" + intf + "/" + tty,
+		}
+	}
+	unplug := func(n string) {
+		os.RemoveAll(filepath.Join(root, "sys/class/tty/ttyUSB"+n))
+		os.RemoveAll(filepath.Join(root, "sys/devices/pci0000:00/0000:00:14.0/usb1/1-"+n))
+	}
+
+	fakeTree(t, root, usbPort("0", "A0"))
+
+	src := newChanSource()
+	w := &Watcher{
+		Lister: PortLister{
+			SysfsRoot: filepath.Join(root, "sys"),
+			DevRoot:   filepath.Join(root, "dev"),
+		},
+		Source: src,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := w.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(typ PortEventType, name, serial string) {
+		t.Helper()
+		select {
+		case ev := <-ch:
+			if ev.Err != nil || ev.Type != typ || ev.Port.Name != name || ev.Port.SerialNumber != serial {
+				t.Fatalf("got event %v %s (%s), err %v, want %v %s (%s)",
+					ev.Type, ev.Port.Name, ev.Port.SerialNumber, ev.Err, typ, name, serial)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %v %s", typ, name)
+		}
+	}
+	idle := func() {
+		t.Helper()
+		select {
+		case <-src.idle:
+		case ev := <-ch:
+			t.Fatalf("got unexpected event %+v", ev)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for watcher to become idle")
+		}
+	}
+
+	// present from the start
+	expect(PortAdded, "ttyUSB0", "A0")
+
+	// spurious wakeup, nothing changed
+	idle()
+	src.wake <- nil
+
+	idle()
+	fakeTree(t, root, usbPort("1", "A1"))
+	src.wake <- nil
+	expect(PortAdded, "ttyUSB1", "A1")
+
+	// replaced by a different adapter between two scans
+	idle()
+	unplug("0")
+	fakeTree(t, root, usbPort("0", "B0"))
+	src.wake <- nil
+	expect(PortRemoved, "ttyUSB0", "A0")
+	expect(PortAdded, "ttyUSB0", "B0")
+
+	idle()
+	unplug("0")
+	unplug("1")
+	src.wake <- nil
+	expect(PortRemoved, "ttyUSB0", "B0")
+	expect(PortRemoved, "ttyUSB1", "A1")
+
+	idle()
+	srcErr := errors.New("source failed")
+	src.wake <- srcErr
+	ev, ok := <-ch
+	if !ok || ev.Err != srcErr {
+		t.Fatalf("got event %+v, ok %v, want error %v", ev, ok, srcErr)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("channel not closed after error")
+	}
+}
+
+func TestWatcherCancel(t *testing.T) {
+	root, err := ioutil.TempDir("", "sers-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	fakeTree(t, root, map[string]string{"sys/class/tty/tty0/dev": "4:0\n"})
+
+	w := &Watcher{
+		Lister: PortLister{SysfsRoot: filepath.Join(root, "sys")},
+		Source: newChanSource(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := w.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case ev, ok := <-ch:
+		if ok {
+			t.Fatalf("got event %+v after cancelling", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancelling")
+	}
+}
+
+func TestParseUevent(t *testing.T) {
+	msg := []byte("add@/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0\x00" +
+		"ACTION=add\x00" +
+		"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0\x00" +
+		"SUBSYSTEM=tty\x00" +
+		"MAJOR=188\x00MINOR=0\x00DEVNAME=ttyUSB0\x00SEQNUM=4711\x00")
+
+	action, subsystem := parseUevent(msg)
+	if action != "add" || subsystem != "tty" {
+		t.Errorf("got action %q, subsystem %q, want add, tty", action, subsystem)
+	}
+}
+
+func TestUeventSourceLost(t *testing.T) {
+	// overflows of the socket buffer wake up the Watcher and reading goes
+	// on, until the socket is closed.
+	reads := []error{
+		&os.PathError{Op: "read", Path: "uevent", Err: syscall.ENOBUFS},
+		syscall.EINTR,
+		os.ErrClosed,
+	}
+	read := func(p []byte) (int, error) {
+		err := reads[0]
+		reads = reads[1:]
+		return 0, err
+	}
+
+	us := &UeventSource{changes: make(chan struct{}, 1)}
+	done := make(chan struct{})
+	go func() {
+		us.receive(read)
+		close(done)
+	}()
+	<-done
+
+	if err := us.Wait(context.Background()); err != nil {
+		t.Errorf("Wait after lost uevents returned %v, want a wakeup", err)
+	}
+	if err := us.Wait(context.Background()); err == nil {
+		t.Error("Wait after closing the socket succeeded")
+	}
+	if len(reads) != 0 {
+		t.Errorf("%d reads left", len(reads))
+	}
+}
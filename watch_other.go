@@ -0,0 +1,7 @@
+// +build !linux
+
+package sers
+
+func defaultPortEventSource() PortEventSource {
+	return &PollSource{}
+}